@@ -0,0 +1,346 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package chaos
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/rotator"
+)
+
+type Op string
+
+const (
+	// OpRecreate deletes the file and creates a new one at the same path, the
+	// file system might reuse the inode
+	OpRecreate Op = "recreate"
+	// OpTruncate truncates the file in place without rotating it
+	OpTruncate Op = "truncate"
+	// OpChmod removes all permissions from the file, making it unreadable to non root agents
+	OpChmod Op = "chmod"
+	// OpHardlink replaces the file by a hard link to a copy of it
+	OpHardlink Op = "hardlink"
+	// OpSymlink switches the target of a symlinked file to a new file
+	OpSymlink Op = "symlink"
+)
+
+var allOps = []Op{OpRecreate, OpTruncate, OpChmod, OpHardlink, OpSymlink}
+
+func ParseOp(s string) (Op, error) {
+	for _, op := range allOps {
+		if string(op) == strings.TrimSpace(s) {
+			return op, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported chaos operation '%v', expecting one of %v", s, allOps)
+}
+
+// Target is a file chaos operations are applied to.
+type Target struct {
+	Path string
+	// Name returns the file the operations are applied to when it is not at
+	// Path, e.g. the current file of a logfile rotated to timestamped names
+	Name func() string
+	// Reopen is called after the file at Path is replaced, so its writer continues with the new file
+	Reopen func() error
+}
+
+// Event describes an operation applied to a target.
+type Event struct {
+	Time   time.Time
+	Op     Op
+	Path   string
+	Values map[string]interface{}
+	Err    error
+}
+
+type Opt func(s *Scheduler)
+
+// OptRestore restores the permissions of files made unreadable by OpChmod after d.
+func OptRestore(d time.Duration) func(s *Scheduler) {
+	return func(s *Scheduler) {
+		s.restore = d
+	}
+}
+
+// OptOnEvent calls f for every operation applied.
+func OptOnEvent(f func(e Event)) func(s *Scheduler) {
+	return func(s *Scheduler) {
+		s.onEvent = f
+	}
+}
+
+// Scheduler applies chaos operations to the targets at given times or randomly.
+type Scheduler struct {
+	targets []Target
+	restore time.Duration
+	onEvent func(e Event)
+
+	mu   sync.Mutex
+	rand *rand.Rand
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewScheduler(targets []Target, opts ...Opt) *Scheduler {
+	s := &Scheduler{
+		targets: targets,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		done:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// At applies op to every target once d has passed.
+func (s *Scheduler) At(op Op, d time.Duration) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+			s.mu.Lock()
+			targets := s.targets
+			s.mu.Unlock()
+			for _, tg := range targets {
+				s.Apply(op, tg)
+			}
+		case <-s.done:
+		}
+	}()
+}
+
+// Random applies one of ops to one of the targets at random, with exponentially
+// distributed delays averaging mean, until Stop is called.
+func (s *Scheduler) Random(ops []Op, mean time.Duration) {
+	if len(ops) == 0 {
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			s.mu.Lock()
+			d := time.Duration(s.rand.ExpFloat64() * float64(mean))
+			s.mu.Unlock()
+
+			t := time.NewTimer(d)
+			select {
+			case <-t.C:
+				// Targets are picked when applied, as they change with churn
+				s.mu.Lock()
+				op := ops[s.rand.Intn(len(ops))]
+				var tg Target
+				ok := len(s.targets) > 0
+				if ok {
+					tg = s.targets[s.rand.Intn(len(s.targets))]
+				}
+				s.mu.Unlock()
+				if ok {
+					s.Apply(op, tg)
+				}
+			case <-s.done:
+				t.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Add adds a target, e.g. a logfile created after the scheduler was started.
+func (s *Scheduler) Add(tg Target) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.targets = append(s.targets, tg)
+}
+
+// Remove removes the target at path before its file is retired.
+func (s *Scheduler) Remove(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, tg := range s.targets {
+		if tg.Path == path {
+			s.targets = append(s.targets[:i:i], s.targets[i+1:]...)
+			return
+		}
+	}
+}
+
+// Stop cancels pending operations and waits for running ones, permissions
+// not restored yet are restored.
+func (s *Scheduler) Stop() {
+	close(s.done)
+	s.wg.Wait()
+}
+
+// Apply applies op to the target right away.
+func (s *Scheduler) Apply(op Op, tg Target) error {
+	path := tg.Path
+	if tg.Name != nil {
+		path = tg.Name()
+	}
+	log.Printf("Applying chaos operation %v to %v", op, path)
+	e := Event{Time: time.Now(), Op: op, Path: path, Values: make(map[string]interface{})}
+
+	switch op {
+	case OpRecreate:
+		e.Err = s.recreate(path, tg, e.Values)
+	case OpTruncate:
+		e.Err = s.truncate(path, e.Values)
+	case OpChmod:
+		e.Err = s.chmod(path, e.Values)
+	case OpHardlink:
+		e.Err = s.hardlink(path, tg, e.Values)
+	case OpSymlink:
+		e.Err = s.symlink(path, tg, e.Values)
+	default:
+		e.Err = fmt.Errorf("unsupported chaos operation '%v'", op)
+	}
+
+	if e.Err != nil {
+		log.Printf("Failed to apply chaos operation %v to %v: %v", op, path, e.Err)
+	}
+	if s.onEvent != nil {
+		s.onEvent(e)
+	}
+	return e.Err
+}
+
+func (s *Scheduler) recreate(path string, tg Target, values map[string]interface{}) error {
+	values["inode_before"] = inode(path)
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	values["inode_after"] = inode(path)
+	return reopen(tg)
+}
+
+func (s *Scheduler) truncate(path string, values map[string]interface{}) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	values["size_before"] = fi.Size()
+	return os.Truncate(path, 0)
+}
+
+func (s *Scheduler) chmod(path string, values map[string]interface{}) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	mode := fi.Mode().Perm()
+	values["mode_before"] = fmt.Sprintf("%#o", mode)
+	if err := os.Chmod(path, 0); err != nil {
+		return err
+	}
+
+	if s.restore > 0 {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			// Stop restores right away rather than leave the file unreadable
+			t := time.NewTimer(s.restore)
+			defer t.Stop()
+			select {
+			case <-t.C:
+			case <-s.done:
+			}
+			if err := os.Chmod(path, mode); err != nil {
+				log.Printf("Failed to restore mode of %v: %v", path, err)
+			}
+		}()
+	}
+	return nil
+}
+
+func (s *Scheduler) hardlink(path string, tg Target, values map[string]interface{}) error {
+	values["inode_before"] = inode(path)
+
+	// The copy stays as a second link to the new inode
+	link := path + ".chaos"
+	if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := rotator.CopyFile(path, link); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	if err := os.Link(link, path); err != nil {
+		return err
+	}
+	values["inode_after"] = inode(path)
+	return reopen(tg)
+}
+
+func (s *Scheduler) symlink(path string, tg Target, values map[string]interface{}) error {
+	old, err := os.Readlink(path)
+	if err != nil {
+		return fmt.Errorf("%v is not a symlink: %w", path, err)
+	}
+	values["target_before"] = old
+
+	target := fmt.Sprintf("%v.chaos-%v", filepath.Base(path), time.Now().UnixNano())
+	f, err := os.Create(filepath.Join(filepath.Dir(path), target))
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	values["target_after"] = target
+	return reopen(tg)
+}
+
+func reopen(tg Target) error {
+	if tg.Reopen == nil {
+		return nil
+	}
+	return tg.Reopen()
+}
@@ -0,0 +1,199 @@
+package chaos
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/rotator"
+)
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "chaos")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	return dir
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %v: %v", path, err)
+	}
+	return string(b)
+}
+
+// newWriter creates a logfile at dir/app.log with content written to it
+func newWriter(t *testing.T, dir, content string) (string, *rotator.Writer) {
+	t.Helper()
+	path := filepath.Join(dir, "app.log")
+	w, err := rotator.NewWriter(rotator.NewFileRotator(path, 1), rotator.Config{})
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	if _, err := w.Write([]byte(content)); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	return path, w
+}
+
+func TestTruncate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path, w := newWriter(t, dir, "before\n")
+	defer w.Close()
+
+	var events []Event
+	s := NewScheduler(nil, OptOnEvent(func(e Event) { events = append(events, e) }))
+	if err := s.Apply(OpTruncate, Target{Path: path, Reopen: w.Reopen}); err != nil {
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+	if got := readFile(t, path); got != "" {
+		t.Errorf("Expecting %v to be empty, got %q", path, got)
+	}
+	if len(events) != 1 || events[0].Values["size_before"] != int64(len("before\n")) {
+		t.Errorf("Expecting one event with the size before, got %v", events)
+	}
+}
+
+func TestRecreate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path, w := newWriter(t, dir, "old\n")
+	defer w.Close()
+
+	s := NewScheduler(nil)
+	if err := s.Apply(OpRecreate, Target{Path: path, Reopen: w.Reopen}); err != nil {
+		t.Fatalf("Failed to recreate: %v", err)
+	}
+	w.Write([]byte("new\n"))
+	if got := readFile(t, path); got != "new\n" {
+		t.Errorf("Expecting the writer to continue with the new file, got %q", got)
+	}
+}
+
+func TestChmodRestore(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path, w := newWriter(t, dir, "line\n")
+	defer w.Close()
+
+	mode := func() os.FileMode {
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Failed to stat %v: %v", path, err)
+		}
+		return fi.Mode().Perm()
+	}
+	before := mode()
+
+	s := NewScheduler(nil, OptRestore(20*time.Millisecond))
+	if err := s.Apply(OpChmod, Target{Path: path}); err != nil {
+		t.Fatalf("Failed to chmod: %v", err)
+	}
+	if m := mode(); m != 0 {
+		t.Errorf("Expecting no permissions, got %v", m)
+	}
+	for i := 0; i < 100 && mode() != before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if m := mode(); m != before {
+		t.Errorf("Expecting permissions %v to be restored, got %v", before, m)
+	}
+
+	// Stop restores permissions whose restore is still pending
+	s = NewScheduler(nil, OptRestore(time.Hour))
+	if err := s.Apply(OpChmod, Target{Path: path}); err != nil {
+		t.Fatalf("Failed to chmod: %v", err)
+	}
+	s.Stop()
+	if m := mode(); m != before {
+		t.Errorf("Expecting permissions %v to be restored on stop, got %v", before, m)
+	}
+}
+
+func TestHardlink(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path, w := newWriter(t, dir, "old\n")
+	defer w.Close()
+
+	s := NewScheduler(nil)
+	if err := s.Apply(OpHardlink, Target{Path: path, Reopen: w.Reopen}); err != nil {
+		t.Fatalf("Failed to hardlink: %v", err)
+	}
+	w.Write([]byte("new\n"))
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat %v: %v", path, err)
+	}
+	li, err := os.Stat(path + ".chaos")
+	if err != nil {
+		t.Fatalf("Failed to stat link: %v", err)
+	}
+	if !os.SameFile(fi, li) {
+		t.Errorf("Expecting %v to be a hard link of %v.chaos", path, path)
+	}
+	if got := readFile(t, path); got != "old\nnew\n" {
+		t.Errorf("Expecting the copy to keep the content and get new lines, got %q", got)
+	}
+}
+
+func TestSymlink(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	if err := ioutil.WriteFile(path+".0", []byte("old\n"), 0644); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := os.Symlink("app.log.0", path); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	reopened := false
+	s := NewScheduler(nil)
+	err := s.Apply(OpSymlink, Target{Path: path, Reopen: func() error {
+		reopened = true
+		return nil
+	}})
+	if err != nil {
+		t.Fatalf("Failed to switch symlink: %v", err)
+	}
+	target, err := os.Readlink(path)
+	if err != nil {
+		t.Fatalf("Failed to read symlink: %v", err)
+	}
+	if target == "app.log.0" {
+		t.Errorf("Expecting the symlink to be switched to a new file")
+	}
+	if got := readFile(t, path); got != "" {
+		t.Errorf("Expecting the new target to be empty, got %q", got)
+	}
+	if !reopened {
+		t.Errorf("Expecting the target to be reopened")
+	}
+}
+
+func TestTargetName(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	current := filepath.Join(dir, "app-2024-01-01-13.log")
+	if err := ioutil.WriteFile(current, []byte("line\n"), 0644); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	// Nothing exists at the path itself, like logfiles rotated to timestamped names
+	tg := Target{Path: filepath.Join(dir, "app.log"), Name: func() string { return current }}
+	if err := NewScheduler(nil).Apply(OpTruncate, tg); err != nil {
+		t.Fatalf("Failed to truncate: %v", err)
+	}
+	if got := readFile(t, current); got != "" {
+		t.Errorf("Expecting %v to be truncated, got %q", current, got)
+	}
+}
@@ -0,0 +1,322 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/resource"
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/timeline"
+)
+
+// stderrLines is the number of last lines of the stderr of the agent reported when it crashes
+const stderrLines = 20
+
+// agent runs the agent command, it records when the agent exits before being
+// stopped and optionally restarts it.
+type agent struct {
+	name         string
+	args         []string
+	pipeOutput   bool
+	restart      bool
+	restartDelay time.Duration
+	tl           *timeline.Timeline
+	// cgroup is the group the agent is launched in, nil to stay in the group of logbench
+	cgroup *resource.Cgroup
+
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	exited   chan struct{}
+	stopping bool
+	// stopped is closed by stop, restarting tracks the restarts in progress
+	stopped    chan struct{}
+	restarting sync.WaitGroup
+	// outages are the times the agent was down, the end of an ongoing outage is zero
+	outages []outage
+}
+
+type outage struct {
+	start, end time.Time
+}
+
+func newAgent(pipeOutput, restart bool, restartDelay time.Duration, cgroup *resource.Cgroup, tl *timeline.Timeline, name string, args []string) *agent {
+	return &agent{name: name, args: args, pipeOutput: pipeOutput, restart: restart, restartDelay: restartDelay, cgroup: cgroup, tl: tl, stopped: make(chan struct{})}
+}
+
+// start starts the agent command
+func (a *agent) start() error {
+	cmd, exited, err := a.launch()
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.cmd, a.exited = cmd, exited
+	a.mu.Unlock()
+	return nil
+}
+
+// launch starts the agent command and watches for it to exit, the returned
+// channel is closed once it exited.
+func (a *agent) launch() (*exec.Cmd, chan struct{}, error) {
+	cmd := exec.Command(a.name, a.args...)
+	if a.cgroup != nil {
+		// A shell moves itself into the group before executing the agent, so
+		// the agent and all its children start in the group.
+		args := append([]string{"-c", `echo $$ > "$0" && exec "$@"`, a.cgroup.ProcsFile(), a.name}, a.args...)
+		cmd = exec.Command("/bin/sh", args...)
+	}
+	// Stderr is read from a pipe of our own instead of having exec copy it,
+	// as Wait would block until children that outlive the agent exit.
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create pipe for the agent stderr: %w", err)
+	}
+	cmd.Stderr = pw
+	if a.pipeOutput {
+		cmd.Stdout = os.Stdout
+	}
+	err = cmd.Start()
+	pw.Close()
+	if err != nil {
+		pr.Close()
+		return nil, nil, fmt.Errorf("failed to execute command %v with params %v, error: %v", a.name, a.args, err)
+	}
+
+	stderr := &tailWriter{n: stderrLines}
+	var out io.Writer = stderr
+	if a.pipeOutput {
+		out = io.MultiWriter(os.Stderr, stderr)
+	}
+	read := make(chan struct{})
+	go func() {
+		io.Copy(out, pr)
+		pr.Close()
+		close(read)
+	}()
+
+	exited := make(chan struct{})
+	go func() {
+		err := cmd.Wait()
+		// Wait a little for the last lines written before exiting
+		select {
+		case <-read:
+		case <-time.After(100 * time.Millisecond):
+		}
+		close(exited)
+		a.onExit(cmd, stderr, err)
+	}()
+	return cmd, exited, nil
+}
+
+// onExit records a crash of the agent and restarts it if enabled
+func (a *agent) onExit(cmd *exec.Cmd, stderr *tailWriter, err error) {
+	a.mu.Lock()
+	if a.stopping {
+		a.mu.Unlock()
+		return
+	}
+	// Added under the lock, so stop either waits for the restart or it is skipped
+	a.restarting.Add(1)
+	defer a.restarting.Done()
+	now := time.Now()
+	a.outages = append(a.outages, outage{start: now})
+	a.mu.Unlock()
+
+	lines := stderr.Lines()
+	log.Printf("Agent with pid %v exited unexpectedly, state: %v, error: %v", cmd.Process.Pid, cmd.ProcessState, err)
+	if len(lines) > 0 {
+		log.Printf("Last lines of the agent stderr:\n%v", strings.Join(lines, "\n"))
+	}
+	a.tl.Record(timeline.Event{Time: now, Kind: eventCrash, Values: map[string]interface{}{
+		"pid":       cmd.Process.Pid,
+		"exit_code": cmd.ProcessState.ExitCode(),
+		"state":     cmd.ProcessState.String(),
+		"stderr":    lines,
+	}})
+
+	if !a.restart {
+		return
+	}
+	select {
+	case <-time.After(a.restartDelay):
+	case <-a.stopped:
+		return
+	}
+	cmd, exited, err := a.launch()
+	if err != nil {
+		log.Printf("Failed to restart agent: %v", err)
+		return
+	}
+
+	a.mu.Lock()
+	if a.stopping {
+		// The agent was stopped while restarting, the new one has to go as well
+		a.mu.Unlock()
+		interrupt(cmd, exited)
+		return
+	}
+	a.cmd, a.exited = cmd, exited
+	o := &a.outages[len(a.outages)-1]
+	o.end = time.Now()
+	down := o.end.Sub(o.start)
+	a.mu.Unlock()
+
+	log.Printf("Agent restarted with pid %v after %v", cmd.Process.Pid, down.Round(time.Millisecond))
+	a.tl.Record(timeline.Event{Time: o.end, Kind: eventRestart, Values: map[string]interface{}{
+		"pid":      cmd.Process.Pid,
+		"downtime": down.Seconds(),
+	}})
+}
+
+// pid returns the pid of the running agent, or noPid if it is down
+func (a *agent) pid() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	select {
+	case <-a.exited:
+		return noPid
+	default:
+		return a.cmd.Process.Pid
+	}
+}
+
+// stop stops the agent, a restart in progress is waited for and the
+// restarted agent stopped as well
+func (a *agent) stop() {
+	a.mu.Lock()
+	a.stopping = true
+	close(a.stopped)
+	a.mu.Unlock()
+	a.restarting.Wait()
+
+	a.mu.Lock()
+	cmd, exited := a.cmd, a.exited
+	a.mu.Unlock()
+
+	select {
+	case <-exited:
+		return
+	default:
+	}
+	interrupt(cmd, exited)
+}
+
+// interrupt stops cmd with SIGINT, it is killed if still alive 5 seconds later
+func interrupt(cmd *exec.Cmd, exited chan struct{}) {
+	cmd.Process.Signal(syscall.SIGINT)
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		log.Println("Agent still alive 5 seconds after SIGINT, kill now")
+		cmd.Process.Kill()
+		<-exited
+	}
+	log.Printf("Agent exited state: %v", cmd.ProcessState)
+}
+
+// downtime returns how long the agent was down between from and to, and the
+// number of times it crashed and was restarted in that time.
+func (a *agent) downtime(from, to time.Time) (time.Duration, int, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var d time.Duration
+	var crashes, restarts int
+	for _, o := range a.outages {
+		start, end := o.start, o.end
+		if end.IsZero() {
+			end = to
+		}
+		if !start.Before(from) && start.Before(to) {
+			crashes++
+		}
+		if !o.end.IsZero() && !o.end.Before(from) && o.end.Before(to) {
+			restarts++
+		}
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if end.After(start) {
+			d += end.Sub(start)
+		}
+	}
+	return d, crashes, restarts
+}
+
+// report prints the crashes, restarts and downtime of the agent over the run
+func (a *agent) report(start time.Time) {
+	d, crashes, restarts := a.downtime(start, time.Now())
+	if crashes == 0 {
+		return
+	}
+	fmt.Printf("Over the whole run, the agent crashed %v times, was restarted %v times and was down for %v\n", crashes, restarts, d.Round(time.Millisecond))
+}
+
+// tailWriter keeps the last n lines written to it
+type tailWriter struct {
+	mu      sync.Mutex
+	n       int
+	lines   []string
+	partial []byte
+}
+
+func (w *tailWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.partial = append(w.partial, b...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.lines = append(w.lines, strings.TrimRight(string(w.partial[:i]), "\r"))
+		w.partial = w.partial[i+1:]
+	}
+	if len(w.lines) > w.n {
+		w.lines = append(w.lines[:0], w.lines[len(w.lines)-w.n:]...)
+	}
+	return len(b), nil
+}
+
+// Lines returns the last lines written, including an unterminated last line
+func (w *tailWriter) Lines() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	lines := append([]string(nil), w.lines...)
+	if len(w.partial) > 0 {
+		lines = append(lines, string(w.partial))
+	}
+	if len(lines) > w.n {
+		lines = lines[len(lines)-w.n:]
+	}
+	return lines
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/timeline"
+)
+
+func TestTailWriter(t *testing.T) {
+	w := &tailWriter{n: 2}
+	w.Write([]byte("one\ntwo\nthr"))
+	w.Write([]byte("ee\r\nfour"))
+
+	if got, want := w.Lines(), []string{"three", "four"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expecting last lines %q, got %q", want, got)
+	}
+}
+
+func TestAgentDowntime(t *testing.T) {
+	start := time.Now()
+	at := func(s int) time.Time {
+		return start.Add(time.Duration(s) * time.Second)
+	}
+	a := &agent{outages: []outage{{at(1), at(3)}, {at(5), at(6)}, {at(9), time.Time{}}}}
+
+	for _, c := range []struct {
+		from, to          int
+		down              time.Duration
+		crashes, restarts int
+	}{
+		{0, 10, 4 * time.Second, 3, 2},
+		{2, 5, time.Second, 0, 1},
+		{4, 8, time.Second, 1, 1},
+		{7, 8, 0, 0, 0},
+	} {
+		d, crashes, restarts := a.downtime(at(c.from), at(c.to))
+		if d != c.down || crashes != c.crashes || restarts != c.restarts {
+			t.Errorf("Expecting downtime %v with %v crashes and %v restarts from %vs to %vs, got %v, %v and %v", c.down, c.crashes, c.restarts, c.from, c.to, d, crashes, restarts)
+		}
+	}
+}
+
+func TestAgentStopWhileRestarting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logbench")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, delay := range []time.Duration{0, time.Hour} {
+		// Every agent started appends its pid and crashes right away
+		pids := filepath.Join(dir, fmt.Sprintf("pids-%v", delay))
+		a := newAgent(false, true, delay, nil, timeline.New(nil), "sh", []string{"-c", `echo $$ >> "$0"; exit 1`, pids})
+		if err := a.start(); err != nil {
+			t.Fatalf("Failed to start agent: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+
+		stopped := make(chan struct{})
+		go func() {
+			a.stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Expecting stop with restart delay %v to return", delay)
+		}
+
+		// Agents that exited are gone or zombies until they are waited for
+		b, err := ioutil.ReadFile(pids)
+		if err != nil {
+			t.Fatalf("Failed to read pids: %v", err)
+		}
+		for _, pid := range strings.Fields(string(b)) {
+			stat, err := ioutil.ReadFile("/proc/" + pid + "/stat")
+			if err == nil && !strings.Contains(string(stat), ") Z ") {
+				t.Errorf("Expecting agent %v restarted with delay %v to be stopped, got %s", pid, delay, stat)
+			}
+		}
+	}
+}
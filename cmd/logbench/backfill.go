@@ -0,0 +1,164 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/generator"
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/resource"
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/rotator"
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/timeline"
+)
+
+// backfill writes size bytes of logs spread evenly over the logfiles, and
+// returns the size of the file every writer ended up writing to by its
+// resolved path.
+func backfill(paths []string, ws []*rotator.Writer, size int64, span time.Duration, opts []generator.Opt) (map[string]int64, error) {
+	fmt.Printf("Backfilling %v bytes of logs over the past %v into %v files ...\n", size, span, len(paths))
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(ws))
+	sem := make(chan struct{}, runtime.NumCPU())
+	for i, w := range ws {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, w *rotator.Writer) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = generator.Backfill(w, size/int64(len(ws)), span, opts...)
+		}(i, w)
+	}
+	wg.Wait()
+
+	sizes := make(map[string]int64)
+	for i, path := range paths {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("failed to backfill %v: %w", path, errs[i])
+		}
+		if err := ws[i].Flush(); err != nil {
+			return nil, fmt.Errorf("failed to flush %v: %w", path, err)
+		}
+		// Nothing is at the path itself with the timestamp scheme
+		rp, err := resolvePath(ws[i].Name())
+		if err != nil {
+			return nil, err
+		}
+		fi, err := os.Stat(rp)
+		if err != nil {
+			return nil, err
+		}
+		sizes[rp] = fi.Size()
+	}
+	fmt.Printf("Backfilled in %v\n", time.Since(start))
+	return sizes, nil
+}
+
+// resolvePath returns the absolute path of the file path refers to, the way
+// it shows up in the open files of the agent.
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// waitCatchUp waits until the agent has read every backfilled file up to its
+// backfilled size, and reports the time it took with the peak cpu and memory
+// usage meanwhile. The agent is looked up again while it is not running, e.g.
+// not started yet or restarting.
+func waitCatchUp(tg *target, sizes map[string]int64, freq, timeout time.Duration, tl *timeline.Timeline) error {
+	fmt.Printf("Waiting for the agent to catch up with %v backfilled files ...\n", len(sizes))
+	start := time.Now()
+	t := time.NewTicker(freq)
+	defer t.Stop()
+
+	var p *resource.Process
+	var pcpu float64
+	var pmem int
+	read := make(map[string]bool)
+	for len(read) < len(sizes) && time.Since(start) < timeout {
+		<-t.C
+		if p == nil {
+			p = attachCatchUp(tg)
+			continue
+		}
+		if err := p.Update(); err != nil {
+			log.Printf("Lost %v with pid %v, looking it up again: %v", tg.name, p.Pid(), err)
+			tg.lost = p.Pid()
+			p = nil
+			continue
+		}
+		if cpu := p.CpuPercent(); cpu > pcpu {
+			pcpu = cpu
+		}
+		if mem := p.Memory(); mem > pmem {
+			pmem = mem
+		}
+
+		// Files are done once read to the end, even if the agent closes them later
+		for path, offset := range p.FileOffsets() {
+			if size, ok := sizes[path]; ok && offset >= size {
+				read[path] = true
+			}
+		}
+		fmt.Printf("CPU: %.1f%% MEM: %v caught up: %v/%v files\n", p.CpuPercent(), p.MemoryHuman(), len(read), len(sizes))
+	}
+
+	elapsed := time.Since(start)
+	if len(read) < len(sizes) {
+		log.Printf("Agent did not catch up with %v of %v backfilled files within %v", len(sizes)-len(read), len(sizes), timeout)
+	}
+	fmt.Printf("Agent caught up with %v/%v backfilled files in %v, peak cpu usage: %.1f%%, peak memory usage: %.1fM\n\n", len(read), len(sizes), elapsed, pcpu, float64(pmem)/1024/1024)
+	tl.Record(timeline.Event{Kind: eventBackfill, Values: map[string]interface{}{
+		"files":       len(sizes),
+		"caught_up":   len(read),
+		"seconds":     elapsed.Seconds(),
+		"peak_cpu":    pcpu,
+		"peak_memory": pmem,
+	}})
+	return nil
+}
+
+// attachCatchUp returns the process of the target to measure catching up with,
+// or nil if it is not running. Like for monitoring, a lost process is only
+// looked up again once restarted with another pid.
+func attachCatchUp(tg *target) *resource.Process {
+	pid := tg.resolve()
+	if pid == noPid || pid == tg.lost {
+		return nil
+	}
+	p, err := resource.FindProcess(pid)
+	if err == nil {
+		err = p.Update()
+	}
+	if err != nil {
+		tg.lost = pid
+		log.Printf("Failed to find process of %v, pid: %v, error: %v", tg.name, pid, err)
+		return nil
+	}
+	return p
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/resource"
+)
+
+// breakdown accumulates the usage of every process and thread name of the
+// agent tree over the samples of a step.
+type breakdown struct {
+	n       int
+	procs   map[int]*procUsage
+	threads map[string]*threadUsage
+}
+
+type procUsage struct {
+	pid           int
+	comm, cmdline string
+	samples       int
+	cpu           float64
+	mem, pss      int64
+	maxMem        int64
+}
+
+type threadUsage struct {
+	name     string
+	cpu      float64
+	maxCount int
+}
+
+func newBreakdown() *breakdown {
+	return &breakdown{procs: make(map[int]*procUsage), threads: make(map[string]*threadUsage)}
+}
+
+// add adds a sample of the process tree p
+func (b *breakdown) add(p *resource.Process) {
+	b.n++
+	for _, u := range p.Breakdown() {
+		pu, ok := b.procs[u.Pid]
+		if !ok {
+			pu = &procUsage{pid: u.Pid}
+			b.procs[u.Pid] = pu
+		}
+		// The command line is empty for zombies, keep the last known one
+		pu.comm = u.Comm
+		if u.Cmdline != "" {
+			pu.cmdline = u.Cmdline
+		}
+		pu.samples++
+		pu.cpu += u.CPU
+		pu.mem += int64(u.Memory)
+		pu.pss += u.PSS
+		if int64(u.Memory) > pu.maxMem {
+			pu.maxMem = int64(u.Memory)
+		}
+	}
+	for _, u := range p.ThreadBreakdown() {
+		tu, ok := b.threads[u.Name]
+		if !ok {
+			tu = &threadUsage{name: u.Name}
+			b.threads[u.Name] = tu
+		}
+		tu.cpu += u.CPU
+		if u.Count > tu.maxCount {
+			tu.maxCount = u.Count
+		}
+	}
+}
+
+// report prints the average usage of every process and thread name, the
+// cpu usage is averaged over all samples of the step and the memory over the
+// samples the process was alive in. PSS is left out unless pss is set.
+func (b *breakdown) report(prefix string, pss bool) {
+	if b.n == 0 {
+		return
+	}
+
+	procs := make([]*procUsage, 0, len(b.procs))
+	for _, pu := range b.procs {
+		procs = append(procs, pu)
+	}
+	sort.Slice(procs, func(i, j int) bool {
+		if procs[i].cpu != procs[j].cpu {
+			return procs[i].cpu > procs[j].cpu
+		}
+		return procs[i].pid < procs[j].pid
+	})
+	fmt.Printf("%v, usage by process:\n", prefix)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	pssHeader := "PSS\t"
+	if !pss {
+		pssHeader = ""
+	}
+	fmt.Fprintf(w, "PID\tCPU\tMEM\tMAX MEM\t%v  COMMAND\n", pssHeader)
+	for _, pu := range procs {
+		cmd := pu.cmdline
+		if cmd == "" {
+			cmd = "[" + pu.comm + "]"
+		}
+		s := int64(pu.samples)
+		var pssCol string
+		if pss {
+			pssCol = resource.HumanSize(pu.pss/s) + "\t"
+		}
+		fmt.Fprintf(w, "%v\t%.1f%%\t%v\t%v\t%v  %v\n", pu.pid, pu.cpu/float64(b.n), resource.HumanSize(pu.mem/s), resource.HumanSize(pu.maxMem), pssCol, cmd)
+	}
+	w.Flush()
+
+	if len(b.threads) == 0 {
+		return
+	}
+	threads := make([]*threadUsage, 0, len(b.threads))
+	for _, tu := range b.threads {
+		threads = append(threads, tu)
+	}
+	sort.Slice(threads, func(i, j int) bool {
+		if threads[i].cpu != threads[j].cpu {
+			return threads[i].cpu > threads[j].cpu
+		}
+		return threads[i].name < threads[j].name
+	})
+	fmt.Printf("%v, usage by thread name:\n", prefix)
+	w = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "THREADS\tCPU\t  NAME\n")
+	for _, tu := range threads {
+		fmt.Fprintf(w, "%v\t%.1f%%\t  %v\n", tu.maxCount, tu.cpu/float64(b.n), tu.name)
+	}
+	w.Flush()
+}
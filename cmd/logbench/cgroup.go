@@ -0,0 +1,128 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/resource"
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/timeline"
+)
+
+// cgroupStep accumulates the usage of the cgroup of the agent over a step
+type cgroupStep struct {
+	c                   *resource.Cgroup
+	start, last         resource.CgroupStats
+	startTime, lastTime time.Time
+	n                   int
+	memory, maxMemory   int64
+	// hasMemory and hasIO are set when the controllers are enabled for the group
+	hasMemory, hasIO bool
+}
+
+func newCgroupStep(c *resource.Cgroup) *cgroupStep {
+	s := &cgroupStep{c: c, startTime: time.Now()}
+	st, err := c.Stats()
+	if err != nil {
+		log.Printf("Failed to read usage of cgroup %v: %v", c.Path(), err)
+	}
+	s.start, s.last, s.lastTime = st, st, s.startTime
+	cs, err := c.Controllers()
+	if err != nil {
+		log.Printf("Failed to read controllers of cgroup %v: %v", c.Path(), err)
+	}
+	for _, c := range cs {
+		s.hasMemory = s.hasMemory || c == "memory"
+		s.hasIO = s.hasIO || c == "io"
+	}
+	return s
+}
+
+// sample reads the usage of the cgroup and records it in the timeline
+func (s *cgroupStep) sample(tl *timeline.Timeline) {
+	now := time.Now()
+	st, err := s.c.Stats()
+	if err != nil {
+		log.Printf("Failed to read usage of cgroup %v: %v", s.c.Path(), err)
+		return
+	}
+
+	d := st.Sub(s.last)
+	elapsed := now.Sub(s.lastTime)
+	tl.Record(timeline.Event{Time: now, Kind: eventCgroup, Source: s.c.Path(), Values: map[string]interface{}{
+		"cpu":               percentOf(d.CPUUsage, elapsed),
+		"throttled":         percentOf(d.Throttled, elapsed),
+		"throttled_periods": d.ThrottledPeriods,
+		"memory":            st.Memory,
+		"memory_high":       d.MemoryEvents.High,
+		"memory_max":        d.MemoryEvents.Max,
+		"oom":               d.MemoryEvents.OOM,
+		"oom_kill":          d.MemoryEvents.OOMKill,
+		"rbytes":            d.IO.RBytes,
+		"wbytes":            d.IO.WBytes,
+	}})
+
+	s.last, s.lastTime = st, now
+	s.n++
+	s.memory += st.Memory
+	if st.Memory > s.maxMemory {
+		s.maxMemory = st.Memory
+	}
+}
+
+// report reports the usage of the cgroup over the step
+func (s *cgroupStep) report(prefix string) {
+	if s.n == 0 {
+		return
+	}
+
+	d := s.last.Sub(s.start)
+	elapsed := s.lastTime.Sub(s.startTime)
+	limit := "none"
+	if s.c.CPUMax() > 0 {
+		limit = fmt.Sprintf("%v cpus", s.c.CPUMax())
+	}
+	fmt.Printf("%v, cgroup cpu usage: %.1f%%, user: %.1f%%, system: %.1f%%, limit: %v\n", prefix, percentOf(d.CPUUsage, elapsed), percentOf(d.CPUUser, elapsed), percentOf(d.CPUSystem, elapsed), limit)
+	if d.Periods > 0 {
+		fmt.Printf("%v, cgroup cpu throttled in %v of %v periods (%.1f%%) for %v\n", prefix, d.ThrottledPeriods, d.Periods, float64(d.ThrottledPeriods)/float64(d.Periods)*100, d.Throttled.Round(time.Millisecond))
+	}
+
+	if s.hasMemory {
+		limit = "none"
+		if s.c.MemoryMax() > 0 {
+			limit = resource.HumanSize(s.c.MemoryMax())
+		}
+		fmt.Printf("%v, cgroup memory average: %v, maximum: %v, limit: %v, events %v\n", prefix, resource.HumanSize(s.memory/int64(s.n)), resource.HumanSize(s.maxMemory), limit, d.MemoryEvents)
+	}
+	if s.hasIO {
+		fmt.Printf("%v, cgroup I/O %v\n", prefix, d.IO)
+	}
+	if d.MemoryEvents.OOMKill > 0 {
+		fmt.Printf("Warning: the OOM killer killed %v processes of the agent at its memory limit\n", d.MemoryEvents.OOMKill)
+	}
+}
+
+// percentOf returns d as a percentage of one cpu over elapsed
+func percentOf(d, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(d) / float64(elapsed) * 100
+}
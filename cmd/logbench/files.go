@@ -0,0 +1,331 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/chaos"
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/generator"
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/rotator"
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/timeline"
+)
+
+var rangePattern = regexp.MustCompile(`\{(\d+)\.\.(\d+)\}`)
+
+// expandPaths expands numeric ranges in paths, e.g. app-{1..3}.log to
+// app-1.log, app-2.log and app-3.log, a leading zero in the range start pads
+// the numbers, e.g. {001..100}.
+func expandPaths(paths []string) ([]string, error) {
+	var result []string
+	for _, p := range paths {
+		m := rangePattern.FindStringSubmatchIndex(p)
+		if m == nil {
+			result = append(result, p)
+			continue
+		}
+
+		from, to := p[m[2]:m[3]], p[m[4]:m[5]]
+		start, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range in path %v: %w", p, err)
+		}
+		end, err := strconv.Atoi(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range in path %v: %w", p, err)
+		}
+		if end < start {
+			return nil, fmt.Errorf("invalid range in path %v: end is smaller than start", p)
+		}
+
+		width := 0
+		if len(from) > 1 && from[0] == '0' {
+			width = len(from)
+		}
+
+		var expanded []string
+		for i := start; i <= end; i++ {
+			expanded = append(expanded, fmt.Sprintf("%v%0*d%v", p[:m[0]], width, i, p[m[1]:]))
+		}
+		// Expand the remaining ranges
+		expanded, err = expandPaths(expanded)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, expanded...)
+	}
+	return result, nil
+}
+
+// rateWeights returns n weights averaging 1 following a Zipf distribution
+// with exponent skew in random order, 0 gives every file the same rate.
+func rateWeights(n int, skew float64) []float64 {
+	ws := make([]float64, n)
+	var sum float64
+	for i := range ws {
+		ws[i] = 1 / math.Pow(float64(i+1), skew)
+		sum += ws[i]
+	}
+	for i := range ws {
+		ws[i] *= float64(n) / sum
+	}
+	rand.Shuffle(n, func(i, j int) {
+		ws[i], ws[j] = ws[j], ws[i]
+	})
+	return ws
+}
+
+// ioModes selects the io mode of logfiles from -iomode values, either a mode
+// for all logfiles or pattern=mode for the logfiles matching a glob pattern,
+// the last matching value wins.
+type ioModes []string
+
+func (ms ioModes) mode(path string) (string, error) {
+	var mode string
+	for _, m := range ms {
+		ps := strings.SplitN(m, "=", 2)
+		if len(ps) == 1 {
+			mode = m
+			continue
+		}
+		ok, err := filepath.Match(ps[0], path)
+		if err != nil {
+			return "", fmt.Errorf("invalid io mode pattern %v: %w", ps[0], err)
+		}
+		if ok {
+			mode = ps[1]
+		}
+	}
+	return mode, nil
+}
+
+// check validates the io modes of paths, multiple writers can only append
+// to files written with write calls, and a mapped file truncated behind the
+// writer's back raises SIGBUS on the next store to the mapping.
+func (ms ioModes) check(paths []string, writers int, truncate bool) error {
+	for _, path := range paths {
+		mode, err := ms.mode(path)
+		if err != nil {
+			return err
+		}
+		if writers > 1 && (mode == rotator.IOModeDirect || mode == rotator.IOModeMmap) {
+			return fmt.Errorf("io mode %v of %v does not support multiple writers", mode, path)
+		}
+		if truncate && mode == rotator.IOModeMmap {
+			return fmt.Errorf("io mode %v of %v does not support the truncate chaos operation", mode, path)
+		}
+	}
+	return nil
+}
+
+type logFile struct {
+	path      string
+	w         *rotator.Writer
+	appenders []*rotator.Appender
+	gens      []*generator.Generator
+	weight    float64
+}
+
+func (f *logFile) setRate(rate float64) {
+	for _, gen := range f.gens {
+		gen.SetRate(rate * f.weight / float64(len(f.gens)))
+	}
+}
+
+func (f *logFile) stop() error {
+	for _, gen := range f.gens {
+		gen.Stop()
+	}
+	for _, a := range f.appenders {
+		if err := a.Close(); err != nil {
+			return err
+		}
+	}
+	return f.w.Close()
+}
+
+// logSet generates logs to a set of logfiles, each with its own share of the
+// rate, and churns the files by creating new ones and retiring old ones.
+type logSet struct {
+	mu      sync.Mutex
+	files   []*logFile
+	rate    float64
+	opts    []generator.Opt
+	rconf   rotator.Config
+	modes   ioModes
+	tl      *timeline.Timeline
+	writers int
+	seq     int
+	remove  bool
+	// group and chaos rotate and apply chaos to churned logfiles as well
+	group *rotator.Group
+	chaos *chaos.Scheduler
+	// retired is the number of bytes written to retired logfiles
+	retired int64
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newLogSet creates generators for the logfiles, with more than one writer
+// per file the additional writers append to the file through their own file
+// descriptors and every line is tagged with its writer and a sequence number.
+func newLogSet(paths []string, ws []*rotator.Writer, skew float64, writers int, rconf rotator.Config, modes ioModes, tl *timeline.Timeline, opts ...generator.Opt) *logSet {
+	if writers < 1 {
+		writers = 1
+	}
+	ls := &logSet{opts: opts, rconf: rconf, modes: modes, tl: tl, writers: writers, done: make(chan struct{})}
+	weights := rateWeights(len(paths), skew)
+	for i, path := range paths {
+		ls.files = append(ls.files, ls.newLogFile(path, ws[i], weights[i]))
+	}
+	return ls
+}
+
+func (ls *logSet) newLogFile(path string, w *rotator.Writer, weight float64) *logFile {
+	f := &logFile{path: path, w: w, weight: weight}
+	if ls.writers == 1 {
+		f.gens = append(f.gens, generator.New(w, ls.opts...))
+		return f
+	}
+
+	for i := 0; i < ls.writers; i++ {
+		var dest io.Writer = w
+		if i > 0 {
+			a := w.NewAppender()
+			f.appenders = append(f.appenders, a)
+			dest = a
+		}
+		opts := append([]generator.Opt{generator.OptSequence(strconv.Itoa(i))}, ls.opts...)
+		f.gens = append(f.gens, generator.New(dest, opts...))
+	}
+	return f
+}
+
+func (ls *logSet) SetRate(rate float64) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	ls.rate = rate
+	for _, f := range ls.files {
+		f.setRate(rate)
+	}
+}
+
+// Churn replaces the oldest logfile by a new one named after template, with
+// {n} replaced by a sequence number, rate times per second until Stop is
+// called. Retired files are deleted along with their backups if remove is set. New logfiles join the
+// rotate group and the chaos targets, retired ones leave them.
+func (ls *logSet) Churn(template string, rate float64, remove bool, group *rotator.Group, cs *chaos.Scheduler) {
+	ls.remove = remove
+	ls.group = group
+	ls.chaos = cs
+	ls.wg.Add(1)
+	go func() {
+		defer ls.wg.Done()
+		t := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := ls.churn(template); err != nil {
+					log.Printf("Failed to churn logfiles: %v", err)
+				}
+			case <-ls.done:
+				return
+			}
+		}
+	}()
+}
+
+func (ls *logSet) churn(template string) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	ls.seq++
+	path := strings.ReplaceAll(template, "{n}", strconv.Itoa(ls.seq))
+	ws, err := createLogFiles([]string{path}, ls.rconf, ls.modes, ls.tl)
+	if err != nil {
+		return err
+	}
+
+	old := ls.files[0]
+	nf := ls.newLogFile(path, ws[0], old.weight)
+	nf.setRate(ls.rate)
+	ls.files = append(ls.files[1:], nf)
+	ls.group.Add(nf.w)
+	ls.chaos.Add(chaosTarget(path, nf.w, ls.rconf.Scheme))
+
+	ls.group.Remove(old.w)
+	ls.chaos.Remove(old.path)
+	if err := old.stop(); err != nil {
+		return fmt.Errorf("failed to close retired logfile %v: %w", old.path, err)
+	}
+	ls.retired += old.w.Written()
+	// The files written differ from the path with the timestamp and symlink schemes
+	if ls.remove {
+		if err := old.w.Remove(); err != nil {
+			return fmt.Errorf("failed to remove retired logfile %v: %w", old.path, err)
+		}
+	}
+
+	ls.tl.Record(timeline.Event{Kind: eventChurn, Source: path, Values: map[string]interface{}{"retired": old.path}})
+	return nil
+}
+
+// Written returns the number of bytes written to all logfiles so far
+func (ls *logSet) Written() int64 {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	n := ls.retired
+	for _, f := range ls.files {
+		n += f.w.Written()
+	}
+	return n
+}
+
+func (ls *logSet) Stop() {
+	close(ls.done)
+	ls.wg.Wait()
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	for _, f := range ls.files {
+		if err := f.stop(); err != nil {
+			log.Printf("Failed to close logfile %v: %v", f.path, err)
+		}
+	}
+}
+
+// churnTemplate derives the name of churned files from path, e.g. app.log
+// becomes app-churn{n}.log.
+func churnTemplate(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-churn{n}" + ext
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/chaos"
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/generator"
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/rotator"
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/timeline"
+)
+
+func TestExpandPaths(t *testing.T) {
+	cases := []struct {
+		paths    []string
+		expected []string
+	}{
+		{[]string{"app.log"}, []string{"app.log"}},
+		{[]string{"app-{1..3}.log", "other.log"}, []string{"app-1.log", "app-2.log", "app-3.log", "other.log"}},
+		{[]string{"app-{08..10}.log"}, []string{"app-08.log", "app-09.log", "app-10.log"}},
+		{[]string{"{1..2}/app-{1..2}.log"}, []string{"1/app-1.log", "1/app-2.log", "2/app-1.log", "2/app-2.log"}},
+	}
+
+	for _, c := range cases {
+		got, err := expandPaths(c.paths)
+		if err != nil {
+			t.Errorf("Failed to expand %v: %v", c.paths, err)
+		}
+		if !reflect.DeepEqual(got, c.expected) {
+			t.Errorf("Expecting %v to expand to %v, got %v", c.paths, c.expected, got)
+		}
+	}
+
+	if _, err := expandPaths([]string{"app-{3..1}.log"}); err == nil {
+		t.Errorf("Expecting a reversed range to fail")
+	}
+}
+
+func TestRateWeights(t *testing.T) {
+	for _, skew := range []float64{0, 1, 2} {
+		ws := rateWeights(100, skew)
+		var sum float64
+		for _, w := range ws {
+			sum += w
+		}
+		if math.Abs(sum-100) > 1e-9 {
+			t.Errorf("Expecting weights with skew %v to average 1, got %v", skew, sum/100)
+		}
+	}
+}
+
+func TestChurn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logbench")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tl := timeline.New(nil)
+	rconf := rotator.Config{Keep: 1}
+	path := filepath.Join(dir, "app.log")
+	ws, err := createLogFiles([]string{path}, rconf, nil, tl)
+	if err != nil {
+		t.Fatalf("Failed to create logfiles: %v", err)
+	}
+	group := rotator.NewGroup(ws, 0)
+	events := make(chan chaos.Event, 2)
+	cs := chaos.NewScheduler([]chaos.Target{chaosTarget(path, ws[0], rconf.Scheme)}, chaos.OptOnEvent(func(e chaos.Event) {
+		events <- e
+	}))
+	ls := newLogSet([]string{path}, ws, 0, 1, rconf, nil, tl, generator.OptLines([]string{FixedLogLine}))
+	ls.group = group
+	ls.chaos = cs
+	defer ls.Stop()
+
+	template := churnTemplate(path)
+	if err := ls.churn(template); err != nil {
+		t.Fatalf("Failed to churn: %v", err)
+	}
+
+	// The retired writer is closed and must not be rotated any more
+	if err := group.RotateAll(); err != nil {
+		t.Errorf("Expecting the group to rotate the churned logfile only, got %v", err)
+	}
+	churned := filepath.Join(dir, "app-churn1.log")
+	if _, err := os.Stat(filepath.Join(dir, "app-churn1.1.log")); err != nil {
+		t.Errorf("Expecting the churned logfile to be rotated: %v", err)
+	}
+
+	cs.At(chaos.OpTruncate, 0)
+	if e := <-events; e.Path != churned {
+		t.Errorf("Expecting chaos to target the churned logfile only, got %v", e.Path)
+	}
+	cs.Stop()
+}
+
+func TestChurnRemove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logbench")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Nothing is written at the path itself with the timestamp scheme
+	tl := timeline.New(nil)
+	rconf := rotator.Config{Keep: 1, Scheme: rotator.SchemeTimestamp, DateFormat: "20060102150405.000000000"}
+	path := filepath.Join(dir, "app.log")
+	ws, err := createLogFiles([]string{path}, rconf, nil, tl)
+	if err != nil {
+		t.Fatalf("Failed to create logfiles: %v", err)
+	}
+	if err := ws[0].Rotate(); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	ls := newLogSet([]string{path}, ws, 0, 1, rconf, nil, tl, generator.OptLines([]string{FixedLogLine}))
+	ls.group = rotator.NewGroup(ws, 0)
+	ls.chaos = chaos.NewScheduler(nil)
+	ls.remove = true
+	defer ls.Stop()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "app-2*"))
+	if len(files) != 2 {
+		t.Fatalf("Expecting the live file and a backup, got %v", files)
+	}
+	if err := ls.churn(churnTemplate(path)); err != nil {
+		t.Fatalf("Failed to churn: %v", err)
+	}
+	files, _ = filepath.Glob(filepath.Join(dir, "app-2*"))
+	if len(files) != 0 {
+		t.Errorf("Expecting the files of the retired logfile to be removed, got %v", files)
+	}
+	files, _ = filepath.Glob(filepath.Join(dir, "app-churn1-*"))
+	if len(files) != 1 {
+		t.Errorf("Expecting the file of the churned logfile only, got %v", files)
+	}
+}
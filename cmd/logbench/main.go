@@ -23,21 +23,30 @@ import (
 	"io"
 	"log"
 	"os"
-	"os/exec"
 	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/chaos"
 	"github.com/awslabs/amazon-log-agent-benchmark-tool/generator"
 	"github.com/awslabs/amazon-log-agent-benchmark-tool/replayer"
 	"github.com/awslabs/amazon-log-agent-benchmark-tool/resource"
 	"github.com/awslabs/amazon-log-agent-benchmark-tool/rotator"
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/timeline"
 )
 
 const (
 	FixedLogLine = "INFO CloudWatchOutput      Amazon::Monitoring::CloudWatchOutput::new - CloudWatchOutput sender=data/cloudwatch/current endpoint=https://monitoring.us-east-1.amazonaws.com maxBytes=76800"
 	noPid        = -1
+
+	eventSample   = "sample"
+	eventRotate   = "rotate"
+	eventChaos    = "chaos"
+	eventChurn    = "churn"
+	eventBackfill = "backfill"
+	eventCrash    = "crash"
+	eventRestart  = "restart"
+	eventCgroup   = "cgroup"
 )
 
 type MultpleValueFlag []string
@@ -58,27 +67,82 @@ var Usage = func() {
 }
 
 func main() {
-	var logfiles, rateStrs MultpleValueFlag
-	var tLength, rampUp, freq, rotateDuration time.Duration
-	var timeLayout, logLine, rotateSizeStr, replay, replayTimeLayout, multilineStart string
-	var pid, rotateKeep int
-	var pipeOutput bool
-	flag.Var(&logfiles, "log", "Path of the log files being generated and writes logs to, you can specify multiple values by using the parameter multiple times or use comma seperated list")
+	var logfiles, rateStrs, chaosAt, chaosRandom, ioModeStrs, contentStrs MultpleValueFlag
+	var tLength, rampUp, freq, backfillSpan, backfillTimeout, splitDelay, rotateDuration, rotateDelay, rotateStagger, rotateMaxAge, syncInterval, chaosInterval, chaosRestore, restartDelay time.Duration
+	var timeLayout, logLine, churnLog, backfillStr, blockSizeStr, preallocateStr, padSizeStr, holeSizeStr, hugeLineStr, rotateSizeStr, rotateLinesStr, rotateArchive, rotateMaxBytesStr, syncBytesStr, timelinePath, rotateScheme, rotateDateFormat, replay, replayTimeLayout, multilineStart string
+	var targets targetFlag
+	var pid, rotateKeep, splitWrites, writers, padEvery, holeEvery, hugeEvery int
+	var rateSkew, churnRate, maxCV, cpuMax float64
+	var leakThresholdStr, cgroupPath, memoryMaxStr string
+	var pipeOutput, crlf, utf16, churnRemove, rotateCompress, rotateDelayCompress, syncOnRotate, rotateAlign, showBreakdown, restart bool
+	flag.Var(&logfiles, "log", "Path of the log files being generated and writes logs to, you can specify multiple values by using the parameter multiple times or use comma seperated list, numeric ranges are expanded, e.g. /tmp/bench/app-{1..5000}.log")
 	flag.Var(&rateStrs, "rate", "Log generation rate to be tested, e.g. -log 1,100,1k,10k,100k, default 100")
+	flag.Float64Var(&rateSkew, "rateskew", 0, "Skew of the rates of the log files following a Zipf distribution with this exponent, the average rate per file stays the same, 0 for the same rate for every file")
+	flag.Float64Var(&churnRate, "churn", 0, "Number of new log files created per second, each replacing the oldest log file which stops being written to")
+	flag.StringVar(&churnLog, "churnlog", "", "Path of the log files created by churn, {n} is replaced by a sequence number, default derived from the first log file, e.g. app-churn{n}.log")
+	flag.BoolVar(&churnRemove, "churnremove", false, "Delete log files retired by churn along with their backups")
 	flag.IntVar(&pid, "p", noPid, "Pid of the agent to check resource usage")
+	flag.Var(&targets, "target", "Agent to check resource usage by name=COMM, cmdline=REGEX, unit=UNIT for a systemd unit or cgroup=PATH, it is looked up again when it restarts, the parameter can be repeated to check several agents")
 	flag.BoolVar(&pipeOutput, "o", false, "Pipe agent output to stdout and stderr")
+	flag.BoolVar(&restart, "restart", false, "Restart the agent when it exits during the run, monitoring continues with the restarted agent")
+	flag.DurationVar(&restartDelay, "restartdelay", time.Second, "Time to wait before restarting the agent after it exited")
+	flag.StringVar(&cgroupPath, "cgroup", "", "Launch the agent in a cgroup v2 group at this path relative to the cgroup root and report its usage, the group is created and removed at exit, an existing group is kept with its limits restored, default /logbench-PID when -cpumax or -memorymax are given")
+	flag.Float64Var(&cpuMax, "cpumax", 0, "Limit the cpu of the agent to this many cpus with cpu.max of its cgroup, e.g. 0.5, 0 for no limit")
+	flag.StringVar(&memoryMaxStr, "memorymax", "", "Limit the memory of the agent to this many bytes with memory.max of its cgroup, e.g. 512m, empty for no limit")
 	flag.StringVar(&replay, "replay", "", "Path to a file for log replay")
 	flag.StringVar(&replayTimeLayout, "replaytimelayout", "", `Format to parse and replace the timestamp for replaying log file, e.g. -replaytimelayout='Mon, 02 Jan 2006 15:04:05 MST', or use a capture group like -replaytimelayout='"timestamp":"(2006-01-02T15:04:05-0700)"' following Go time layout, see: https://golang.org/pkg/time/#pkg-constants`)
 	flag.StringVar(&multilineStart, "multilinestart", "", "Regular expression of a start of a multiline log event")
 	flag.StringVar(&timeLayout, "timelayout", "Jan _2 15:04:05.000000000", "Format to print the timestamp for the log lines, following Go time layout, see: https://golang.org/pkg/time/#pkg-constants")
 	flag.StringVar(&logLine, "line", FixedLogLine, "Content of the log line to be used")
+	flag.IntVar(&writers, "writers", 1, "Number of writers appending to each log file concurrently through their own file descriptors, like a multi-process application, the rate is split between them and every line is tagged with the writer and a sequence number")
+	flag.IntVar(&splitWrites, "splitwrites", 0, "Write every log line in this many parts, to emulate loggers flushing in the middle of a line")
+	flag.DurationVar(&splitDelay, "splitdelay", 0, "Delay between the parts of a log line written with -splitwrites")
+	flag.StringVar(&blockSizeStr, "blocksize", "", "Buffer the log lines and write them in blocks of this size regardless of line boundaries, e.g. 4k")
+	flag.Var(&contentStrs, "content", "Add content to every log line to test encoding handling, 'invalidutf8' adds invalid UTF-8 sequences, 'unicode' mixed scripts and emoji, 'control' control characters, 'ansi' ANSI escape sequences, e.g. -content unicode,ansi")
+	flag.BoolVar(&crlf, "crlf", false, "End log lines with CRLF")
+	flag.BoolVar(&utf16, "utf16", false, "Write logfiles encoded in UTF-16 little endian with a byte order mark")
+	flag.StringVar(&hugeLineStr, "hugeline", "", "Make every -hugeevery log line a huge line with a message of this size, e.g. 1m")
+	flag.IntVar(&hugeEvery, "hugeevery", 1000, "Number of log lines between huge lines of -hugeline")
+	flag.StringVar(&preallocateStr, "preallocate", "", "Preallocate new logfiles to this size with fallocate and write them from the start, so they read as NUL bytes past the written data until rotated, e.g. 10m")
+	flag.StringVar(&padSizeStr, "padsize", "", "Write this many NUL bytes after every -padevery log lines, e.g. 4k")
+	flag.IntVar(&padEvery, "padevery", 100, "Number of log lines between NUL paddings of -padsize")
+	flag.StringVar(&holeSizeStr, "holesize", "", "Leave a sparse hole of this size after every -holeevery log lines, e.g. 1m, not supported with multiple -writers")
+	flag.IntVar(&holeEvery, "holeevery", 100, "Number of log lines between sparse holes of -holesize")
 	flag.DurationVar(&tLength, "t", 10*time.Second, "Test duration, in format supported by time.ParseDuration, default 10s")
 	flag.DurationVar(&rampUp, "r", 1*time.Second, "Ramp up duration, time for agent to stablize, stats will not be collected during the ramp up, default 1s")
+	flag.Float64Var(&maxCV, "maxcv", 0.5, "Warn when the standard deviation of the cpu or memory usage of a step exceeds this fraction of its mean, 0 disables the warning")
+	flag.BoolVar(&showBreakdown, "breakdown", false, "Report the cpu and memory usage of every process of the agent tree and of its threads by name in each step")
+	flag.StringVar(&leakThresholdStr, "leakthreshold", "10m", "Report a suspected memory leak when the memory of the agent grows by more than this many bytes per hour in a step or over the steps at the same rate, empty disables the warning")
 	flag.DurationVar(&freq, "f", 1*time.Second, "Frequency to collect metrics represented in time duration, default 1s")
+	flag.StringVar(&backfillStr, "backfill", "", "Size of logs to write into the log files before the agent is started, spread evenly across the files, e.g. 10g")
+	flag.DurationVar(&backfillSpan, "backfillspan", 24*time.Hour, "Time span the timestamps of the backfilled logs are spread over, ending at the start of the benchmark")
+	flag.DurationVar(&backfillTimeout, "backfilltimeout", 10*time.Minute, "Maximum time to wait for the agent to read all backfilled logs")
+	flag.StringVar(&timelinePath, "timeline", "", "Path of a file to write the benchmark timeline to, with every sample and event as a JSON line")
 
 	flag.IntVar(&rotateKeep, "rotatekeep", 0, "Number of rotation files to keep, 0 to disable rotation")
 	flag.StringVar(&rotateSizeStr, "rotatesize", "", "Size of the logfile before rotation")
 	flag.DurationVar(&rotateDuration, "rotatetime", 0, "How much time the logfile should be rotated")
+	flag.BoolVar(&rotateAlign, "rotatealign", false, "Rotate all logfiles together at multiples of -rotatetime on the wall clock, e.g. 24h rotates them at midnight UTC, instead of every -rotatetime after each logfile was created")
+	flag.StringVar(&rotateLinesStr, "rotatelines", "", "Number of lines in the logfile before rotation")
+	flag.DurationVar(&rotateStagger, "rotatestagger", 0, "Spread rotations of all logfiles triggered by -rotatealign or SIGUSR1 evenly over this duration, 0 to rotate them in lock-step")
+	flag.StringVar(&rotateScheme, "rotatescheme", rotator.SchemeCreate, "How the logfile is rotated, 'create' renames the file and creates a new one, 'copytruncate' copies the file and truncates it in place, 'dateext' renames the file with a date suffix, 'timestamp' creates a new file with a timestamp in the name, 'symlink' switches the log path as a symlink to a new file")
+	flag.StringVar(&rotateDateFormat, "rotatedateformat", "", "Format of the date in rotated file names for the dateext and timestamp rotate schemes, following Go time layout, default '-20060102' for dateext and '2006-01-02-15' for timestamp")
+	flag.BoolVar(&rotateCompress, "rotatecompress", false, "Compress rotated files with gzip in the background, the open descriptors reported for each step show whether the agent keeps rotated or deleted files open")
+	flag.BoolVar(&rotateDelayCompress, "rotatedelaycompress", false, "Leave the most recently rotated file uncompressed until the next rotation, used with -rotatecompress")
+	flag.StringVar(&rotateArchive, "rotatearchive", "", "Directory to move rotated files into, by default they are kept next to the logfile")
+	flag.DurationVar(&rotateMaxAge, "rotatemaxage", 0, "Remove rotated files older than this duration, even when the agent still has them open")
+	flag.StringVar(&rotateMaxBytesStr, "rotatemaxbytes", "", "Remove the oldest rotated files once their total size exceeds this, e.g. 100m")
+	flag.DurationVar(&rotateDelay, "rotatedelay", 0, "Delay between copy and truncate for the copytruncate rotate scheme")
+
+	flag.StringVar(&syncBytesStr, "syncbytes", "", "Fsync the logfile every time this many bytes are written, e.g. 1m")
+	flag.DurationVar(&syncInterval, "syncinterval", 0, "Fsync the logfile periodically at this interval")
+	flag.BoolVar(&syncOnRotate, "synconrotate", false, "Fsync the logfile before it is rotated")
+	flag.Var(&ioModeStrs, "iomode", "How logfiles are opened and written, 'buffered' through the page cache, 'sync' and 'dsync' with O_SYNC and O_DSYNC, 'direct' with O_DIRECT in aligned blocks, 'mmap' through a memory mapping, either for all logfiles or per logfile as pattern=mode, e.g. -iomode sync,/tmp/bench/app-1*.log=mmap")
+
+	flag.Var(&chaosAt, "chaos", "Chaos operations to apply to every logfile at a time after the start, e.g. -chaos truncate@10s,recreate@20s, operations are recreate, truncate, chmod, hardlink and symlink")
+	flag.Var(&chaosRandom, "chaosrandom", "Chaos operations to apply to random logfiles at random times, e.g. -chaosrandom truncate,chmod")
+	flag.DurationVar(&chaosInterval, "chaosinterval", 10*time.Second, "Average time between random chaos operations")
+	flag.DurationVar(&chaosRestore, "chaosrestore", 0, "Time until the permissions of a file made unreadable by the chmod chaos operation are restored, 0 to never restore")
 
 	flag.Parse()
 
@@ -88,6 +152,19 @@ func main() {
 		os.Exit(1)
 	}
 
+	logfiles, err := expandPaths(logfiles)
+	if err != nil {
+		log.Printf("Unable to expand log param: %v", err)
+		Usage()
+		os.Exit(1)
+	}
+	if err := ioModes(ioModeStrs).check(logfiles, writers, hasChaosOp(chaos.OpTruncate, chaosAt, chaosRandom)); err != nil {
+		log.Printf("Invalid iomode param: %v", err)
+		Usage()
+		os.Exit(1)
+	}
+	raiseFileLimit()
+
 	rates, err := parseRates(rateStrs)
 	if err != nil {
 		log.Printf("Unable to parse rate param: %v", err)
@@ -104,131 +181,360 @@ func main() {
 		Usage()
 		os.Exit(1)
 	}
-	rconf := rotator.Config{
-		Keep:     rotateKeep,
-		Duration: rotateDuration,
-		Size:     int64(rsize),
+
+	rlines, err := parseNumber(rotateLinesStr)
+	if err != nil {
+		log.Printf("Unable to parse rotatelines param: %v", err)
+		Usage()
+		os.Exit(1)
+	}
+	rmaxBytes, err := parseNumber(rotateMaxBytesStr)
+	if err != nil {
+		log.Printf("Unable to parse rotatemaxbytes param: %v", err)
+		Usage()
+		os.Exit(1)
+	}
+
+	blockSize, err := parseNumber(blockSizeStr)
+	if err != nil {
+		log.Printf("Unable to parse blocksize param: %v", err)
+		Usage()
+		os.Exit(1)
+	}
+
+	preallocate, err := parseNumber(preallocateStr)
+	if err != nil {
+		log.Printf("Unable to parse preallocate param: %v", err)
+		Usage()
+		os.Exit(1)
+	}
+	if preallocate > 0 && writers > 1 {
+		log.Printf("Preallocated logfiles do not support multiple writers")
+		Usage()
+		os.Exit(1)
+	}
+
+	padSize, err := parseNumber(padSizeStr)
+	if err != nil {
+		log.Printf("Unable to parse padsize param: %v", err)
+		Usage()
+		os.Exit(1)
+	}
+
+	holeSize, err := parseNumber(holeSizeStr)
+	if err != nil {
+		log.Printf("Unable to parse holesize param: %v", err)
+		Usage()
+		os.Exit(1)
+	}
+	if holeSize > 0 && holeEvery > 0 && writers > 1 {
+		log.Printf("Holes in logfiles do not support multiple writers")
+		Usage()
+		os.Exit(1)
 	}
 
-	files, err := createLogFiles(logfiles, rconf)
+	hugeLine, err := parseNumber(hugeLineStr)
 	if err != nil {
-		log.Fatalf("Failed to create logfiles: %v", err)
+		log.Printf("Unable to parse hugeline param: %v", err)
+		Usage()
+		os.Exit(1)
 	}
 
-	// Start the agent if specified
-	args := flag.Args()
-	var cmd *exec.Cmd
-	if len(args) > 0 {
-		cmd, err = startAgent(pipeOutput, args[0], args[1:])
+	var contents []generator.Content
+	for _, s := range contentStrs {
+		c, err := generator.ParseContent(s)
 		if err != nil {
-			log.Fatalf("Failed to start agent with error: %v", err)
+			log.Printf("Invalid content param: %v", err)
+			Usage()
+			os.Exit(1)
+		}
+		contents = append(contents, c)
+	}
+	for _, c := range contents {
+		// Invalid UTF-8 cannot be transcoded to UTF-16
+		if c == generator.ContentInvalidUTF8 && utf16 {
+			log.Printf("The invalidutf8 content is not supported with utf16")
+			Usage()
+			os.Exit(1)
 		}
-		pid = cmd.Process.Pid
-		fmt.Println("Agent running with PID: ", pid)
-		defer func() {
-			fmt.Println("Stopping the agent ...")
-			stopAgent(cmd)
-		}()
 	}
 
-	if pid == noPid {
-		fmt.Println("No agent command or agent pid given, just generating logs instead.")
+	leakThreshold, err := parseNumber(leakThresholdStr)
+	if err != nil {
+		log.Printf("Unable to parse leakthreshold param: %v", err)
+		Usage()
+		os.Exit(1)
 	}
 
-	if replay != "" {
-		for _, wf := range files {
-			rf, err := os.Open(replay)
-			if err != nil {
-				log.Fatalf("Unable to open source file '%v' to replay, err: '%v'", replay, err)
-			}
+	memoryMax, err := parseNumber(memoryMaxStr)
+	if err != nil {
+		log.Printf("Unable to parse memorymax param: %v", err)
+		Usage()
+		os.Exit(1)
+	}
+	if cgroupPath == "" && (cpuMax > 0 || memoryMax > 0) {
+		cgroupPath = fmt.Sprintf("/logbench-%v", os.Getpid())
+	}
+	if cgroupPath != "" && len(flag.Args()) == 0 {
+		log.Printf("The cgroup, cpumax and memorymax params require an agent command")
+		Usage()
+		os.Exit(1)
+	}
 
-			var opts []replayer.Opt
-			if multilineStart != "" {
-				opts = append(opts, replayer.OptMultilineStartPattern(multilineStart))
-			}
+	backfillSize, err := parseNumber(backfillStr)
+	if err != nil {
+		log.Printf("Unable to parse backfill param: %v", err)
+		Usage()
+		os.Exit(1)
+	}
+
+	syncBytes, err := parseNumber(syncBytesStr)
+	if err != nil {
+		log.Printf("Unable to parse syncbytes param: %v", err)
+		Usage()
+		os.Exit(1)
+	}
+
+	// A period rounding down to 0 would panic the churn ticker
+	if churnRate != 0 && !(churnRate > 0 && time.Duration(float64(time.Second)/churnRate) > 0) {
+		log.Printf("The churn param must be a positive rate of at most 1e9 per second")
+		Usage()
+		os.Exit(1)
+	}
+
+	if len(chaosRandom) > 0 && chaosInterval <= 0 {
+		log.Printf("The chaosinterval param must be positive to apply random chaos operations")
+		Usage()
+		os.Exit(1)
+	}
+
+	rconf := rotator.Config{
+		Keep:  rotateKeep,
+		Size:  int64(rsize),
+		Lines: int64(rlines),
+
+		Scheme:        rotateScheme,
+		TruncateDelay: rotateDelay,
+		DateFormat:    rotateDateFormat,
+		Compress:      rotateCompress,
+		DelayCompress: rotateDelayCompress,
+		ArchiveDir:    rotateArchive,
+		MaxAge:        rotateMaxAge,
+		MaxBytes:      int64(rmaxBytes),
+
+		SyncBytes:    int64(syncBytes),
+		SyncInterval: syncInterval,
+		SyncOnRotate: syncOnRotate,
+
+		Preallocate: int64(preallocate),
+	}
+	// Aligned time based rotation is driven by the rotate group below
+	if !rotateAlign {
+		rconf.Duration = rotateDuration
+	}
+	if utf16 {
+		rconf.Header = generator.UTF16BOM
+	}
 
-			if replayTimeLayout != "" {
-				opts = append(opts, replayer.OptTimeLayout(replayTimeLayout))
+	// The benchmark returns its errors instead of exiting, so its deferred
+	// stop of the agent and removal of the cgroup run before logbench exits
+	run := func() error {
+		var tlw io.Writer
+		if timelinePath != "" {
+			f, err := os.Create(timelinePath)
+			if err != nil {
+				return fmt.Errorf("failed to create timeline file: %w", err)
 			}
+			defer f.Close()
+			tlw = f
+		}
+		tl := timeline.New(tlw)
 
-			replayer.NewReplayer(rf, wf, opts...)
+		files, err := createLogFiles(logfiles, rconf, ioModes(ioModeStrs), tl)
+		if err != nil {
+			return fmt.Errorf("failed to create logfiles: %w", err)
 		}
-		runTest(tLength, freq, pid, args)
-	} else {
-		var opts []generator.Opt
-		if timeLayout != "" {
-			opts = append(opts, generator.OptTimeLayout(timeLayout))
+		defer closeLogFiles(files)
+
+		group := rotator.NewGroup(files, rotateStagger)
+		if rotateAlign && rotateDuration > 0 {
+			group.RotateEvery(rotateDuration, func(err error) {
+				log.Printf("Failed to rotate logfiles: %v", err)
+			})
+			defer group.Stop()
 		}
+		rotateOnSignal(group)
 
-		gens := generator.NewFixed(logLine, files, opts...)
+		var genOpts []generator.Opt
+		if timeLayout != "" {
+			genOpts = append(genOpts, generator.OptTimeLayout(timeLayout))
+		}
+		genOpts = append(genOpts, generator.OptLines([]string{logLine}))
+		if len(contents) > 0 {
+			genOpts = append(genOpts, generator.OptContent(contents...))
+		}
+		if hugeLine > 0 && hugeEvery > 0 {
+			genOpts = append(genOpts, generator.OptHugeLines(hugeEvery, int(hugeLine)))
+		}
+		if crlf {
+			genOpts = append(genOpts, generator.OptCRLF())
+		}
+		if utf16 {
+			genOpts = append(genOpts, generator.OptUTF16())
+		}
 
-		for _, rate := range rates {
-			gens.SetRate(rate)
-			fmt.Printf("Ramping up for rate %v for %v ...\n", rate, rampUp)
-			time.Sleep(rampUp)
-			runTest(tLength, freq, pid, args)
+		var backfilled map[string]int64
+		if backfillSize > 0 {
+			opts := append([]generator.Opt{generator.OptRotateSize(rconf.Size)}, genOpts...)
+			backfilled, err = backfill(logfiles, files, int64(backfillSize), backfillSpan, opts)
+			if err != nil {
+				return fmt.Errorf("failed to backfill logfiles: %w", err)
+			}
 		}
 
-		fmt.Println("Stopping generators ...")
-		gens.Stop()
-	}
-}
+		// Start the agent if specified
+		args := flag.Args()
+		var ag *agent
+		var cg *resource.Cgroup
+		if cgroupPath != "" {
+			cg, err = resource.NewCgroup(cgroupPath, resource.OptCPUMax(cpuMax), resource.OptMemoryMax(int64(memoryMax)))
+			if err != nil {
+				return fmt.Errorf("failed to create cgroup for the agent: %w", err)
+			}
+			if cg.Created() {
+				fmt.Printf("Agent cgroup: %v\n", cg.Path())
+			} else {
+				fmt.Printf("Agent cgroup: %v, existing, kept with its limits restored at exit\n", cg.Path())
+			}
+			// Removed after the agent is stopped, if it was created
+			defer func() {
+				if err := cg.Remove(); err != nil {
+					log.Printf("Failed to remove the agent cgroup: %v", err)
+				}
+			}()
+		}
+		if len(args) > 0 {
+			ag = newAgent(pipeOutput, restart, restartDelay, cg, tl, args[0], args[1:])
+			if err := ag.start(); err != nil {
+				return fmt.Errorf("failed to start agent: %w", err)
+			}
+			pid = ag.pid()
+			fmt.Println("Agent running with PID: ", pid)
+			agentStart := time.Now()
+			defer func() {
+				fmt.Println("Stopping the agent ...")
+				ag.stop()
+				ag.report(agentStart)
+			}()
+		}
 
-func runTest(tLength, freq time.Duration, pid int, args []string) {
-	start := time.Now()
-	t := time.NewTicker(freq)
+		var ts []*target
+		if ag != nil {
+			ts = append(ts, agentTarget(ag))
+		} else if pid != noPid {
+			ts = append(ts, pidTarget(pid))
+		}
+		ts = append(ts, targets...)
 
-	var scpu, sres, mres float64
-	var n int
-	var p *resource.Process
-	if pid != noPid {
-		var err error
-		p, err = resource.FindProcess(pid)
-		if err != nil {
-			if len(args) > 0 {
-				log.Fatalf("Failed to find process for command %v with params %v, pid: %v, error: %v", args[0], args[1:], pid, err)
-			} else {
-				log.Fatalf("Failed to find process for pid: %v, error: %v", pid, err)
+		if len(ts) == 0 {
+			fmt.Println("No agent command, agent pid or target given, just generating logs instead.")
+		} else if backfilled != nil {
+			if err := waitCatchUp(ts[0], backfilled, freq, backfillTimeout, tl); err != nil {
+				return fmt.Errorf("failed to measure catching up with backfilled logs: %w", err)
 			}
 		}
-		// Initialize cpu usage data
-		err = p.Update()
+
+		cs, err := startChaos(logfiles, files, rotateScheme, chaosAt, chaosRandom, chaosInterval, chaosRestore, tl)
 		if err != nil {
-			log.Fatalf("Failed to initialize resource usage: %v", err)
+			return fmt.Errorf("failed to schedule chaos operations: %w", err)
 		}
-		<-t.C
-	}
+		defer cs.Stop()
 
-	for n = 0; time.Now().Sub(start) < tLength; n++ {
-		if p != nil {
-			err := p.Update()
-			if err != nil {
-				log.Fatalf("Failed to update resource usage: %v", err)
+		m := &monitor{freq: freq, targets: ts, agent: ag, cgroup: cg, args: args, tl: tl, maxCV: maxCV, leakThreshold: leakThreshold, breakdown: showBreakdown, start: time.Now()}
+		defer m.reportRun()
+
+		if replay != "" {
+			for _, wf := range files {
+				rf, err := os.Open(replay)
+				if err != nil {
+					return fmt.Errorf("unable to open source file '%v' to replay: %w", replay, err)
+				}
+
+				var opts []replayer.Opt
+				if multilineStart != "" {
+					opts = append(opts, replayer.OptMultilineStartPattern(multilineStart))
+				}
+
+				if replayTimeLayout != "" {
+					opts = append(opts, replayer.OptTimeLayout(replayTimeLayout))
+				}
+
+				replayer.NewReplayer(rf, wf, opts...)
 			}
-			cpu := p.CpuPercent()
-			fmt.Printf("CPU: %.1f%% MEM: %v \n", cpu, p.MemoryHuman())
-			scpu += cpu
-			mbf := float64(p.Memory())
-			sres += mbf
-			if mres < mbf {
-				mres = mbf
+			m.written = func() int64 {
+				var n int64
+				for _, f := range files {
+					n += f.Written()
+				}
+				return n
 			}
+			m.runTest(tLength)
 		} else {
-			fmt.Printf(".")
+			if splitWrites > 1 {
+				genOpts = append(genOpts, generator.OptSplitWrites(splitWrites, splitDelay))
+			}
+			if blockSize > 0 {
+				genOpts = append(genOpts, generator.OptBlockBuffer(int(blockSize)))
+			}
+			if padSize > 0 && padEvery > 0 {
+				genOpts = append(genOpts, generator.OptPadding(padEvery, int(padSize)))
+			}
+			if holeSize > 0 && holeEvery > 0 {
+				genOpts = append(genOpts, generator.OptHoles(holeEvery, int64(holeSize)))
+			}
+
+			ls := newLogSet(logfiles, files, rateSkew, writers, rconf, ioModes(ioModeStrs), tl, genOpts...)
+			m.written = ls.Written
+			if churnRate > 0 {
+				if churnLog == "" {
+					churnLog = churnTemplate(logfiles[0])
+				}
+				ls.Churn(churnLog, churnRate, churnRemove, group, cs)
+			}
+
+			for _, rate := range rates {
+				ls.SetRate(rate)
+				fmt.Printf("Ramping up for rate %v for %v ...\n", rate, rampUp)
+				time.Sleep(rampUp)
+				m.rate = rate
+				m.runTest(tLength)
+			}
+
+			fmt.Println("Stopping generators ...")
+			ls.Stop()
 		}
-		<-t.C
+		return nil
 	}
-	fmt.Println()
-	t.Stop()
-	if pid != noPid && n > 0 {
-		fmt.Printf("In the past %v, average cpu usage: %.1f%%, average memory usage: %.1fM, maximium memory usage: %.1fM\n\n", tLength, scpu/float64(n), sres/float64(n)/1024/1024, mres/1024/1024)
+	if err := run(); err != nil {
+		log.Fatalf("Benchmark failed: %v", err)
 	}
 }
 
-func createLogFiles(paths []string, rconf rotator.Config) ([]io.Writer, error) {
-	var ws []io.Writer
+func createLogFiles(paths []string, rconf rotator.Config, modes ioModes, tl *timeline.Timeline) ([]*rotator.Writer, error) {
+	var ws []*rotator.Writer
 	for _, path := range paths {
-		w, err := rotator.NewWriter(rotator.NewFileRotator(path, rconf.Keep), rconf)
+		c := rconf
+		c.OnRotate = rotateRecorder(path, tl)
+		mode, err := modes.mode(path)
+		if err != nil {
+			return nil, err
+		}
+		c.IOMode = mode
+		r, err := rotator.NewRotator(path, c)
+		if err != nil {
+			return nil, err
+		}
+		w, err := rotator.NewWriter(r, c)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create file %v: %w", path, err)
 		}
@@ -237,39 +543,88 @@ func createLogFiles(paths []string, rconf rotator.Config) ([]io.Writer, error) {
 	return ws, nil
 }
 
-func startAgent(pipeOutput bool, c string, args []string) (*exec.Cmd, error) {
-	cmd := exec.Command(c, args...)
-	if pipeOutput {
-		stdout, err := cmd.StdoutPipe()
+func rotateRecorder(path string, tl *timeline.Timeline) func(e rotator.Event) {
+	return func(e rotator.Event) {
+		tl.Record(timeline.Event{
+			Time:   e.Time,
+			Kind:   eventRotate,
+			Source: path,
+			Values: map[string]interface{}{"scheme": e.Scheme, "bytes": e.Bytes, "lines": e.Lines},
+		})
+	}
+}
+
+// chaosTarget targets the current file of a logfile rotated to timestamped
+// names, as nothing is ever written at its path.
+func chaosTarget(path string, w *rotator.Writer, scheme string) chaos.Target {
+	tg := chaos.Target{Path: path, Reopen: w.Reopen}
+	if scheme == rotator.SchemeTimestamp {
+		tg.Name = w.Name
+	}
+	return tg
+}
+
+// hasChaosOp returns whether op is among the chaos operations given as op@time
+// or random operations.
+func hasChaosOp(op chaos.Op, at, random []string) bool {
+	for _, s := range append(append([]string{}, at...), random...) {
+		if strings.TrimSpace(strings.SplitN(s, "@", 2)[0]) == string(op) {
+			return true
+		}
+	}
+	return false
+}
+
+// startChaos schedules chaos operations given as op@time and random operations on the logfiles
+func startChaos(paths []string, ws []*rotator.Writer, scheme string, at, random []string, interval, restore time.Duration, tl *timeline.Timeline) (*chaos.Scheduler, error) {
+	var targets []chaos.Target
+	for i, path := range paths {
+		targets = append(targets, chaosTarget(path, ws[i], scheme))
+	}
+
+	cs := chaos.NewScheduler(targets, chaos.OptRestore(restore), chaos.OptOnEvent(func(e chaos.Event) {
+		values := e.Values
+		values["op"] = e.Op
+		if e.Err != nil {
+			values["error"] = e.Err.Error()
+		}
+		tl.Record(timeline.Event{Time: e.Time, Kind: eventChaos, Source: e.Path, Values: values})
+	}))
+
+	for _, s := range at {
+		ps := strings.SplitN(s, "@", 2)
+		if len(ps) != 2 {
+			return nil, fmt.Errorf("invalid chaos operation '%v', expecting op@time", s)
+		}
+		op, err := chaos.ParseOp(ps[0])
 		if err != nil {
 			return nil, err
 		}
-		go func() {
-			io.Copy(os.Stdout, stdout)
-		}()
-		stderr, err := cmd.StderrPipe()
+		d, err := time.ParseDuration(ps[1])
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("invalid time of chaos operation '%v': %w", s, err)
 		}
-		go func() {
-			io.Copy(os.Stderr, stderr)
-		}()
+		cs.At(op, d)
 	}
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("failed to execute command %v with params %v, error: %v", args[0], args[1:], err)
+
+	var ops []chaos.Op
+	for _, s := range random {
+		op, err := chaos.ParseOp(s)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
 	}
-	return cmd, nil
+	cs.Random(ops, interval)
+	return cs, nil
 }
 
-func stopAgent(cmd *exec.Cmd) {
-	cmd.Process.Signal(syscall.SIGINT)
-	go func() {
-		time.Sleep(5 * time.Second)
-		log.Println("Agent still alive 5 seconds after SIGINT, kill now")
-		cmd.Process.Kill()
-	}()
-	err := cmd.Wait()
-	log.Printf("Agent exited state: %v, error: %v", cmd.ProcessState, err)
+func closeLogFiles(ws []*rotator.Writer) {
+	for _, w := range ws {
+		if err := w.Close(); err != nil {
+			log.Printf("Failed to close logfile: %v", err)
+		}
+	}
 }
 
 func parseRates(strs []string) ([]float64, error) {
@@ -300,7 +655,6 @@ func parseNumber(str string) (float64, error) {
 
 	switch lb {
 	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-		n = n
 	case 'k':
 		n *= 1000
 	case 'm':
@@ -0,0 +1,429 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/resource"
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/stats"
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/timeline"
+)
+
+// monitor samples the resource usage of the agents in every step of a run
+type monitor struct {
+	freq    time.Duration
+	targets []*target
+	args    []string
+	tl      *timeline.Timeline
+	// written returns the number of bytes of logs written so far
+	written func() int64
+	// maxCV is the coefficient of variation above which a step is too noisy
+	maxCV float64
+	// leakThreshold is the memory growth in bytes per hour reported as a leak
+	leakThreshold float64
+	// breakdown enables reporting the usage of every process and thread name
+	breakdown bool
+	// agent is the agent started by logbench, it is nil when attached to a running agent
+	agent *agent
+	// cgroup is the group the agent was launched in, nil if none
+	cgroup *resource.Cgroup
+
+	// rate of the current step and start of the run, for the memory trend
+	// of the run
+	rate  float64
+	start time.Time
+}
+
+// step accumulates the samples of a target in a step
+type step struct {
+	t *target
+	p *resource.Process
+	// prefix of the lines reported
+	prefix string
+
+	// missing are the details left out as they could not be read
+	missing                   map[string]bool
+	io                        resource.IO
+	startFDs, lastFDs         resource.FDs
+	startThreads, lastThreads int
+	maxFDs, maxThreads        int
+	vctxt, nvctxt             int64
+	smaps                     resource.Smaps
+	bd                        *breakdown
+
+	// Every sample is kept for the distribution of the step
+	cpus, mems, psss []float64
+	times            []time.Time
+}
+
+// runTest monitors the agents for tLength and reports the resource usage of
+// the step, when an agent exits monitoring continues once it is restarted.
+func (m *monitor) runTest(tLength time.Duration) {
+	start := time.Now()
+	next := m.tl.Len()
+	t := time.NewTicker(m.freq)
+	startWritten := m.written()
+
+	var steps []*step
+	for _, tg := range m.targets {
+		s := &step{t: tg, prefix: fmt.Sprintf("In the past %v", tLength), missing: make(map[string]bool)}
+		if len(m.targets) > 1 {
+			s.prefix = fmt.Sprintf("In the past %v for %v", tLength, tg.name)
+		}
+		if m.breakdown {
+			s.bd = newBreakdown()
+		}
+		s.p = m.attach(tg)
+		steps = append(steps, s)
+	}
+	var cs *cgroupStep
+	if m.cgroup != nil {
+		cs = newCgroupStep(m.cgroup)
+	}
+	if len(steps) > 0 {
+		<-t.C
+	}
+
+	for time.Now().Sub(start) < tLength {
+		now := time.Now()
+		// Only events recorded since the last ones printed, events recorded
+		// while printing are printed on the next tick
+		var es []timeline.Event
+		es, next = m.tl.From(next, eventRotate, eventChaos)
+		if len(es) > 0 {
+			if len(steps) == 0 || steps[0].p == nil {
+				fmt.Println()
+			}
+			for _, e := range es {
+				fmt.Println(e)
+			}
+		}
+
+		var sampled bool
+		for _, s := range steps {
+			if s.p != nil {
+				if err := s.p.Update(); err != nil {
+					log.Printf("Stopped monitoring %v with pid %v: %v", s.t.name, s.p.Pid(), err)
+					s.t.lost = s.p.Pid()
+					s.p = nil
+				}
+			}
+			if s.p != nil {
+				m.sample(s, now)
+				sampled = true
+			} else if s.p = m.attach(s.t); s.p != nil {
+				// The I/O of a restarted agent counts from its start
+				s.io = s.io.Add(s.p.IO())
+			}
+		}
+		if cs != nil {
+			cs.sample(m.tl)
+		}
+		if !sampled {
+			fmt.Printf(".")
+		}
+		<-t.C
+	}
+	fmt.Println()
+	t.Stop()
+	for _, s := range steps {
+		m.report(s, tLength, m.written()-startWritten)
+	}
+	if cs != nil {
+		cs.report(fmt.Sprintf("In the past %v", tLength))
+	}
+	if m.agent != nil {
+		if d, crashes, restarts := m.agent.downtime(start, time.Now()); d > 0 {
+			fmt.Printf("In the past %v, the agent crashed %v times, was restarted %v times and was down for %v\n", tLength, crashes, restarts, d.Round(time.Millisecond))
+		}
+	}
+	if rs := m.tl.Since(start, eventRotate); len(rs) > 0 {
+		fmt.Printf("In the past %v, log files were rotated %v times\n", tLength, len(rs))
+	}
+	fmt.Println()
+}
+
+// sample records the resource usage of the target of s, details that could
+// not be read are left out.
+func (m *monitor) sample(s *step, now time.Time) {
+	p := s.p
+	missing := m.unavailable(s)
+	cpu := p.CpuPercent()
+	io := p.IODelta()
+	fds, threads := p.FDs(), p.Threads()
+	v, nv := p.CtxtSwitchesDelta()
+	smaps := p.Smaps()
+	var source string
+	if len(m.targets) > 1 {
+		source = s.t.name
+		fmt.Printf("%v: ", source)
+	}
+
+	line := fmt.Sprintf("CPU: %.1f%% MEM: %v", cpu, p.MemoryHuman())
+	values := map[string]interface{}{
+		"cpu":    cpu,
+		"memory": p.Memory(),
+	}
+	if !missing[resource.DetailSmaps] {
+		line += fmt.Sprintf(" PSS: %v USS: %v", resource.HumanSize(smaps.PSS), resource.HumanSize(smaps.USS))
+		values["pss"] = smaps.PSS
+		values["uss"] = smaps.USS
+		values["anon"] = smaps.Anon
+		values["file"] = smaps.File
+		values["swap"] = smaps.Swap
+		s.smaps = s.smaps.Add(smaps)
+		s.psss = append(s.psss, float64(smaps.PSS))
+	}
+	if !missing[resource.DetailIO] {
+		line += fmt.Sprintf(" READ: %v WRITE: %v", resource.HumanSize(io.RChar), resource.HumanSize(io.WChar))
+		values["rchar"] = io.RChar
+		values["wchar"] = io.WChar
+		values["syscr"] = io.SyscR
+		values["syscw"] = io.SyscW
+		values["read_bytes"] = io.ReadBytes
+		values["write_bytes"] = io.WriteBytes
+		s.io = s.io.Add(io)
+	}
+	if !missing[resource.DetailFDs] {
+		line += fmt.Sprintf(" FDS: %v", fds.Total())
+		values["fds_files"] = fds.Files
+		values["fds_deleted"] = fds.Deleted
+		values["fds_sockets"] = fds.Sockets
+		values["fds_pipes"] = fds.Pipes
+		values["fds_inotify"] = fds.Inotify
+		values["fds_other"] = fds.Other
+		if len(s.cpus) == 0 {
+			s.startFDs = fds
+		}
+		s.lastFDs = fds
+		if fds.Total() > s.maxFDs {
+			s.maxFDs = fds.Total()
+		}
+	}
+	if !missing[resource.DetailStatus] {
+		line += fmt.Sprintf(" THREADS: %v", threads)
+		values["threads"] = threads
+		values["voluntary_ctxt_switches"] = v
+		values["nonvoluntary_ctxt_switches"] = nv
+		if len(s.cpus) == 0 {
+			s.startThreads = threads
+		}
+		s.lastThreads = threads
+		if threads > s.maxThreads {
+			s.maxThreads = threads
+		}
+		s.vctxt += v
+		s.nvctxt += nv
+	}
+	fmt.Println(line)
+	m.tl.Record(timeline.Event{Kind: eventSample, Source: source, Values: values})
+
+	s.cpus = append(s.cpus, cpu)
+	s.mems = append(s.mems, float64(p.Memory()))
+	s.times = append(s.times, now)
+	if s.bd != nil {
+		s.bd.add(p)
+	}
+	tr := s.t.trend(m.rate)
+	tr.times = append(tr.times, now)
+	tr.rss = append(tr.rss, float64(p.Memory()))
+	if m.rate > 0 {
+		s.t.normalized.times = append(s.t.normalized.times, now)
+		s.t.normalized.rss = append(s.t.normalized.rss, float64(p.Memory())/(m.rate/1000))
+	}
+}
+
+// unavailable returns the details of the target of s that could not be read
+// in the last update. The error of each detail is logged once per target and
+// the detail is left out of the report of the step.
+func (m *monitor) unavailable(s *step) map[string]bool {
+	errs := s.p.Unavailable()
+	details := make([]string, 0, len(errs))
+	for d := range errs {
+		details = append(details, d)
+	}
+	sort.Strings(details)
+
+	missing := make(map[string]bool)
+	for _, d := range details {
+		missing[d] = true
+		s.missing[d] = true
+		if !s.t.unavailable[d] {
+			s.t.unavailable[d] = true
+			log.Printf("Unable to read %v of %v, leaving it out: %v", d, s.t.name, errs[d])
+		}
+	}
+	return missing
+}
+
+// report reports the resource usage of the target of s in the step, written
+// is the number of bytes of logs written in the step.
+func (m *monitor) report(s *step, tLength time.Duration, written int64) {
+	n := len(s.cpus)
+	if n == 0 {
+		return
+	}
+	s.t.trend(m.rate).steps++
+	if m.rate > 0 {
+		s.t.normalized.steps++
+	}
+	cpu, mem, pss := stats.Summarize(s.cpus), stats.Summarize(megabytes(s.mems)), stats.Summarize(megabytes(s.psss))
+	fmt.Printf("%v, average cpu usage: %.1f%%, average memory usage: %.1fM, maximium memory usage: %.1fM\n", s.prefix, cpu.Mean, mem.Mean, mem.Max)
+	fmt.Printf("%v, cpu usage %v\n", s.prefix, cpu.Format("%.1f%%"))
+	fmt.Printf("%v, memory usage %v\n", s.prefix, mem.Format("%.1fM"))
+	if !s.missing[resource.DetailSmaps] {
+		fmt.Printf("%v, pss %v\n", s.prefix, pss.Format("%.1fM"))
+		avg := func(v int64) float64 {
+			return float64(v) / float64(n) / 1024 / 1024
+		}
+		fmt.Printf("%v, average pss: %.1fM, uss: %.1fM, anonymous: %.1fM, file backed: %.1fM, swap: %.1fM\n", s.prefix, avg(s.smaps.PSS), avg(s.smaps.USS), avg(s.smaps.Anon), avg(s.smaps.File), avg(s.smaps.Swap))
+	}
+	for _, c := range []struct {
+		name string
+		sum  stats.Summary
+	}{{"cpu", cpu}, {"memory", mem}} {
+		if m.maxCV > 0 && c.sum.CV() > m.maxCV {
+			fmt.Printf("Warning: %v usage varies by %.0f%% of its mean, more than %.0f%%, the results of this step are too noisy to trust\n", c.name, c.sum.CV()*100, m.maxCV*100)
+		}
+	}
+	m.reportTrend(s.prefix, s.times, s.mems, true)
+	if !s.missing[resource.DetailIO] {
+		fmt.Printf("%v, agent I/O %v\n", s.prefix, s.io)
+	}
+	if !s.missing[resource.DetailFDs] {
+		fmt.Printf("%v, open descriptors went from %v to %v, maximum %v\n", s.prefix, s.startFDs.Total(), s.lastFDs, s.maxFDs)
+	}
+	if !s.missing[resource.DetailStatus] {
+		fmt.Printf("%v, threads went from %v to %v, maximum %v, context switches: %v voluntary, %v involuntary\n", s.prefix, s.startThreads, s.lastThreads, s.maxThreads, s.vctxt, s.nvctxt)
+	}
+	if written > 0 && !s.missing[resource.DetailIO] {
+		fmt.Printf("%v, %v of logs were written, the agent read %.2f bytes per byte written\n", s.prefix, resource.HumanSize(written), float64(s.io.RChar)/float64(written))
+	}
+	if s.bd != nil {
+		s.bd.report(s.prefix, !s.missing[resource.DetailSmaps])
+	}
+}
+
+// attach finds the process of the target and initializes its usage data, it
+// returns nil if the target is not running.
+func (m *monitor) attach(t *target) *resource.Process {
+	pid := t.resolve()
+	// The process is only looked up again once restarted with another pid
+	if pid == noPid || pid == t.lost {
+		return nil
+	}
+
+	p, err := resource.FindProcess(pid)
+	if err == nil {
+		if m.breakdown {
+			p.TrackThreads()
+		}
+		err = p.Update()
+	}
+	if err != nil {
+		t.lost = pid
+		if t.name == "agent" && len(m.args) > 0 {
+			log.Printf("Failed to find process for command %v with params %v, pid: %v, error: %v", m.args[0], m.args[1:], pid, err)
+		} else {
+			log.Printf("Failed to find process of %v, pid: %v, error: %v", t.name, pid, err)
+		}
+		return nil
+	}
+	if t.lost != noPid {
+		fmt.Printf("\nMonitoring %v with pid %v\n", t.name, pid)
+	}
+	return p
+}
+
+// reportRun reports the memory trend of every target over all steps at the
+// same rate, for rates tested in more than one step, and over all steps with
+// the memory divided by the rate. Memory usually grows with the rate, so a
+// trend through steps at different rates would look like a leak, and the trend
+// of a single step is reported with the step.
+func (m *monitor) reportRun() {
+	run := time.Since(m.start).Round(time.Second)
+	for _, t := range m.targets {
+		suffix := ""
+		if len(m.targets) > 1 {
+			suffix = " for " + t.name
+		}
+		var single []string
+		for _, rate := range t.rates {
+			tr := t.trends[rate]
+			if tr.steps < 2 {
+				single = append(single, fmt.Sprint(rate))
+				continue
+			}
+			prefix := fmt.Sprintf("Over the %v steps at rate %v of the run of %v%v", tr.steps, rate, run, suffix)
+			m.reportTrend(prefix, tr.times, tr.rss, true)
+		}
+		if len(single) == 1 {
+			fmt.Printf("Over the run of %v%v, no memory trend at rate %v, tested in a single step\n", run, suffix, single[0])
+		} else if len(single) > 1 {
+			fmt.Printf("Over the run of %v%v, no memory trend at rates %v, each tested in a single step\n", run, suffix, strings.Join(single, ", "))
+		}
+
+		// The leak threshold is in bytes, it does not apply to the memory per rate
+		if t.normalized.steps < 2 {
+			fmt.Printf("Over the run of %v%v, no memory trend per 1k lines/s of rate, %v steps with a rate\n", run, suffix, t.normalized.steps)
+			continue
+		}
+		prefix := fmt.Sprintf("Over the %v steps of the run of %v%v, per 1k lines/s of rate", t.normalized.steps, run, suffix)
+		m.reportTrend(prefix, t.normalized.times, t.normalized.rss, false)
+	}
+}
+
+// reportTrend fits a line through the rss samples and reports the memory
+// growth per hour, with leak set a growth above the leak threshold that is
+// significant at 95% confidence is reported as a suspected leak.
+func (m *monitor) reportTrend(prefix string, times []time.Time, rss []float64, leak bool) {
+	if len(rss) < 3 {
+		fmt.Printf("%v, no memory trend, %v samples are too few\n", prefix, len(rss))
+		return
+	}
+	hours := make([]float64, len(times))
+	for i, t := range times {
+		hours[i] = t.Sub(times[0]).Hours()
+	}
+	r := stats.LinearRegression(hours, rss)
+	c := r.SlopeConfidence()
+	fmt.Printf("%v, memory grew %v per hour, 95%% confidence interval ±%v, r² %.2f\n", prefix, signedSize(r.Slope), resource.HumanSize(int64(c)), r.R2)
+	if leak && m.leakThreshold > 0 && r.Slope > m.leakThreshold && r.Slope-c > 0 {
+		fmt.Printf("Warning: suspected memory leak, memory grew %v per hour, more than %v per hour\n", signedSize(r.Slope), resource.HumanSize(int64(m.leakThreshold)))
+	}
+}
+
+func megabytes(bs []float64) []float64 {
+	ms := make([]float64, len(bs))
+	for i, b := range bs {
+		ms[i] = b / 1024 / 1024
+	}
+	return ms
+}
+
+func signedSize(s float64) string {
+	if s < 0 {
+		return "-" + resource.HumanSize(int64(-s))
+	}
+	return resource.HumanSize(int64(s))
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/awslabs/amazon-log-agent-benchmark-tool/resource"
+)
+
+// target is an agent process monitored with its descendants
+type target struct {
+	name string
+	// resolve returns the pid of the agent, or noPid if it is not running
+	resolve func() int
+	// lost is the pid of the last process of the target that exited
+	lost int
+	// unavailable are the details whose read error was already logged
+	unavailable map[string]bool
+
+	// trends are the samples of the steps by rate, for the memory trend of
+	// every rate tested more than once, in the order of the rates
+	trends map[float64]*trend
+	rates  []float64
+	// normalized holds the samples of every step with a rate, divided by the
+	// rate in 1k lines/s, for the memory trend across all rates
+	normalized trend
+}
+
+// trend holds the rss samples of all steps at a rate
+type trend struct {
+	steps int
+	times []time.Time
+	rss   []float64
+}
+
+// trend returns the trend of the samples at rate
+func (t *target) trend(rate float64) *trend {
+	tr, ok := t.trends[rate]
+	if !ok {
+		tr = &trend{}
+		t.trends[rate] = tr
+		t.rates = append(t.rates, rate)
+	}
+	return tr
+}
+
+func pidTarget(pid int) *target {
+	return &target{name: fmt.Sprintf("pid %v", pid), resolve: func() int { return pid }, lost: noPid, unavailable: make(map[string]bool), trends: make(map[float64]*trend)}
+}
+
+func agentTarget(a *agent) *target {
+	return &target{name: "agent", resolve: a.pid, lost: noPid, unavailable: make(map[string]bool), trends: make(map[float64]*trend)}
+}
+
+// parseTarget parses a target given as name=COMM, cmdline=REGEX, unit=UNIT or
+// cgroup=PATH, the target is looked up again whenever its process exits.
+func parseTarget(s string) (*target, error) {
+	ps := strings.SplitN(s, "=", 2)
+	if len(ps) != 2 || ps[1] == "" {
+		return nil, fmt.Errorf("invalid target '%v', expecting name=COMM, cmdline=REGEX, unit=UNIT or cgroup=PATH", s)
+	}
+
+	var match resource.Matcher
+	switch ps[0] {
+	case "name":
+		match = resource.MatchName(ps[1])
+	case "cmdline":
+		re, err := regexp.Compile(ps[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cmdline pattern of target '%v': %w", s, err)
+		}
+		match = resource.MatchCmdline(re)
+	case "unit":
+		match = resource.MatchUnit(ps[1])
+	case "cgroup":
+		match = resource.MatchCgroup(ps[1])
+	default:
+		return nil, fmt.Errorf("unknown kind of target '%v', expecting name, cmdline, unit or cgroup", ps[0])
+	}
+
+	resolve := func() int {
+		pid, err := resource.FindRoot(match)
+		if err != nil {
+			return noPid
+		}
+		return pid
+	}
+	return &target{name: s, resolve: resolve, lost: noPid, unavailable: make(map[string]bool), trends: make(map[float64]*trend)}, nil
+}
+
+// targetFlag collects the targets given, values are not split on commas as
+// they can be part of a pattern.
+type targetFlag []*target
+
+func (f *targetFlag) String() string {
+	var names []string
+	for _, t := range *f {
+		names = append(names, t.name)
+	}
+	return fmt.Sprintf("%v", names)
+}
+
+func (f *targetFlag) Set(value string) error {
+	t, err := parseTarget(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, t)
+	return nil
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package generator
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+type Content string
+
+const (
+	// ContentInvalidUTF8 adds truncated, overlong and stray UTF-8 sequences
+	ContentInvalidUTF8 Content = "invalidutf8"
+	// ContentUnicode adds text in mixed scripts, right to left text and emoji
+	ContentUnicode Content = "unicode"
+	// ContentControl adds control characters like BEL, backspace and carriage return
+	ContentControl Content = "control"
+	// ContentANSI adds ANSI color and cursor escape sequences
+	ContentANSI Content = "ansi"
+)
+
+var contents = map[Content]string{
+	ContentInvalidUTF8: "\xc3\x28 \xa0\xa1 \xe2\x28\xa1 \xf0\x28\x8c\xbc \xc0\xaf \xff\xfe",
+	ContentUnicode:     "Grüße Ελληνικά Русский 中文 日本語 العربية עברית हिन्दी 🚀 👍🏽 👨‍👩‍👧",
+	ContentControl:     "\x01\x02\x07\x08\x0b\x0c\x1b\x7f\ttab\rreturn",
+	ContentANSI:        "\x1b[31mERROR\x1b[0m \x1b[1;32mOK\x1b[0m \x1b[2K\x1b[1A\x1b]0;title\x07",
+}
+
+var allContents = []Content{ContentInvalidUTF8, ContentUnicode, ContentControl, ContentANSI}
+
+func ParseContent(s string) (Content, error) {
+	for _, c := range allContents {
+		if string(c) == strings.TrimSpace(s) {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported content '%v', expecting one of %v", s, allContents)
+}
+
+// OptContent adds the given kinds of content to every line.
+func OptContent(cs ...Content) func(g *Generator) {
+	return func(g *Generator) {
+		for _, c := range cs {
+			g.content = append(g.content, ' ')
+			g.content = append(g.content, contents[c]...)
+		}
+	}
+}
+
+// OptCRLF ends lines with \r\n instead of \n.
+func OptCRLF() func(g *Generator) {
+	return func(g *Generator) {
+		g.newline = "\r\n"
+	}
+}
+
+// OptUTF16 encodes lines in UTF-16 little endian, the byte order mark at the
+// start of a file is up to the destination.
+func OptUTF16() func(g *Generator) {
+	return func(g *Generator) {
+		g.utf16 = true
+	}
+}
+
+// UTF16BOM is the byte order mark of UTF-16 little endian files
+var UTF16BOM = []byte{0xff, 0xfe}
+
+// OptHugeLines makes every given number of lines a huge line with a message
+// of size bytes.
+func OptHugeLines(every int, size int) func(g *Generator) {
+	return func(g *Generator) {
+		g.hugeEvery = every
+		g.hugeSize = size
+	}
+}
+
+// appendUTF16 appends s encoded in UTF-16 little endian to buf, invalid UTF-8
+// becomes the replacement character.
+func appendUTF16(buf []byte, s string) []byte {
+	for _, r := range utf16.Encode([]rune(s)) {
+		buf = append(buf, byte(r), byte(r>>8))
+	}
+	return buf
+}
@@ -48,6 +48,62 @@ func OptLines(lines []string) func(g *Generator) {
 	}
 }
 
+// OptSplitWrites writes every line in the given number of parts with delay in
+// between, like a logger flushing in the middle of a line.
+func OptSplitWrites(parts int, delay time.Duration) func(g *Generator) {
+	return func(g *Generator) {
+		g.splitParts = parts
+		g.splitDelay = delay
+	}
+}
+
+// OptBlockBuffer buffers the lines and writes them in blocks of size bytes
+// regardless of line boundaries, like a block buffered logger.
+func OptBlockBuffer(size int) func(g *Generator) {
+	return func(g *Generator) {
+		g.blockSize = size
+	}
+}
+
+// OptSequence tags every line with the writer id and a sequence number, so
+// lost, interleaved and torn lines can be detected downstream.
+func OptSequence(writer string) func(g *Generator) {
+	return func(g *Generator) {
+		g.writer = writer
+	}
+}
+
+// OptPadding writes size NUL bytes after every given number of lines, like
+// loggers leaving zeroed regions behind.
+func OptPadding(every int, size int) func(g *Generator) {
+	return func(g *Generator) {
+		g.padEvery = every
+		g.pad = make([]byte, size)
+	}
+}
+
+// OptHoles leaves a sparse hole of size bytes after every given number of
+// lines, the destination has to support holes like rotator.Writer does.
+func OptHoles(every int, size int64) func(g *Generator) {
+	return func(g *Generator) {
+		g.holeEvery = every
+		g.holeSize = size
+	}
+}
+
+// OptRotateSize is the size the destination is rotated at, Backfill writes at
+// most that much at once so files rotated by size are not overshot.
+func OptRotateSize(size int64) func(g *Generator) {
+	return func(g *Generator) {
+		g.rotateSize = size
+	}
+}
+
+// holer is implemented by destinations supporting sparse holes
+type holer interface {
+	Hole(n int64) error
+}
+
 type Generators []*Generator
 
 func (gs Generators) SetRate(r float64) {
@@ -71,6 +127,11 @@ func NewFixed(line string, dests []io.Writer, opts ...Opt) Generators {
 	return gens
 }
 
+// New creates a generator writing to dest, the lines are given by OptLines.
+func New(dest io.Writer, opts ...Opt) *Generator {
+	return newGenerator(dest, opts...)
+}
+
 func NewGeneratorFromFile(path string, dest io.Writer, opts ...Opt) (*Generator, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -98,36 +159,111 @@ type Generator struct {
 	buf            []string
 	idx            int
 	done           chan struct{}
+	stopped        chan struct{}
 	rateCh         chan float64
 	timeFormat     string
 	rotateSize     int64
 	rotateDuratoin time.Duration
+	splitParts     int
+	splitDelay     time.Duration
+	blockSize      int
+	block          []byte
+	writer         string
+	seq            int64
+	lines          int
+	padEvery       int
+	pad            []byte
+	holeEvery      int
+	holeSize       int64
+	content        []byte
+	newline        string
+	utf16          bool
+	hugeEvery      int
+	hugeSize       int
+	formatted      int
 
 	rand *rand.Rand
 }
 
 func newGenerator(dest io.Writer, opts ...Opt) *Generator {
+	g := configure(dest, opts...)
+	g.Start()
+	return g
+}
+
+func configure(dest io.Writer, opts ...Opt) *Generator {
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	g := &Generator{
 		dest:       dest,
 		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
 		rateCh:     make(chan float64),
 		rand:       r,
 		timeFormat: time.StampNano,
+		newline:    "\n",
 	}
 	for _, opt := range opts {
 		opt(g)
 	}
-	g.Start()
 	return g
 }
 
+// Backfill writes size bytes of lines to dest and returns once done, with
+// timestamps spread evenly over the span ending now, like logs that existed
+// before the agent was started.
+func Backfill(dest io.Writer, size int64, span time.Duration, opts ...Opt) error {
+	g := configure(dest, opts...)
+	if len(g.buf) == 0 {
+		return fmt.Errorf("no lines to backfill")
+	}
+
+	now := time.Now()
+	var avg int
+	for _, l := range g.buf {
+		avg += len(now.Format(g.timeFormat)) + len(l) + 2
+	}
+	avg /= len(g.buf)
+	step := span / time.Duration(size/int64(avg)+1)
+
+	// Only write whole lines, so size based rotation never splits a line
+	chunk := 1024 * 1024
+	if g.rotateSize > 0 && g.rotateSize < int64(chunk) {
+		chunk = int(g.rotateSize)
+	}
+	buf := make([]byte, 0, chunk+avg*2)
+	t := now.Add(-span)
+	for written := int64(0); written < size; {
+		n := len(buf)
+		buf = g.appendLine(buf, t)
+		t = t.Add(step)
+
+		// The lines before are written first if the line does not fit the
+		// chunk, a line longer than the chunk is written on its own.
+		if len(buf) > chunk && n > 0 {
+			if _, err := g.dest.Write(buf[:n]); err != nil {
+				return err
+			}
+			written += int64(n)
+			buf = append(buf[:0], buf[n:]...)
+		}
+		if len(buf) >= chunk || written+int64(len(buf)) >= size {
+			if _, err := g.dest.Write(buf); err != nil {
+				return err
+			}
+			written += int64(len(buf))
+			buf = buf[:0]
+		}
+	}
+	return nil
+}
+
 func (g *Generator) SetRate(r float64) {
 	g.rateCh <- r
 }
 
 func (g *Generator) Start() {
 	go func() {
+		defer close(g.stopped)
 		tn := time.Now()
 		t := time.NewTimer(0)
 		<-t.C
@@ -136,7 +272,7 @@ func (g *Generator) Start() {
 			case now := <-t.C:
 				for {
 					tn = tn.Add(g.delay())
-					_, err := fmt.Fprintf(g.dest, "%v %s\n", now.Format(g.timeFormat), g.nextLine())
+					err := g.emit(now)
 					if err != nil {
 						log.Printf("Failed to write to %v with error: %v", g.dest, err)
 					}
@@ -152,14 +288,117 @@ func (g *Generator) Start() {
 				t.Reset(0)
 			case <-g.done:
 				t.Stop()
+				if len(g.block) > 0 {
+					if _, err := g.dest.Write(g.block); err != nil {
+						log.Printf("Failed to write to %v with error: %v", g.dest, err)
+					}
+				}
 				return
 			}
 		}
 	}()
 }
 
+// emit writes the next line followed by any padding or hole due
+func (g *Generator) emit(now time.Time) error {
+	if err := g.write(g.appendLine(nil, now)); err != nil {
+		return err
+	}
+	g.lines++
+	if g.padEvery > 0 && g.lines%g.padEvery == 0 {
+		if err := g.write(g.pad); err != nil {
+			return err
+		}
+	}
+	if g.holeEvery > 0 && g.lines%g.holeEvery == 0 {
+		return g.hole()
+	}
+	return nil
+}
+
+func (g *Generator) hole() error {
+	h, ok := g.dest.(holer)
+	if !ok {
+		return fmt.Errorf("destination %T does not support holes", g.dest)
+	}
+	// The hole goes after the lines written so far
+	if len(g.block) > 0 {
+		if _, err := g.dest.Write(g.block); err != nil {
+			return err
+		}
+		g.block = g.block[:0]
+	}
+	return h.Hole(g.holeSize)
+}
+
+// appendLine appends the next line with timestamp t to buf
+func (g *Generator) appendLine(buf []byte, t time.Time) []byte {
+	start := len(buf)
+	buf = t.AppendFormat(buf, g.timeFormat)
+	buf = append(buf, ' ')
+	if g.writer != "" {
+		g.seq++
+		buf = append(buf, fmt.Sprintf("writer=%v seq=%v ", g.writer, g.seq)...)
+	}
+
+	msg := g.nextLine()
+	buf = append(buf, msg...)
+	g.formatted++
+	if g.hugeEvery > 0 && g.formatted%g.hugeEvery == 0 && len(msg) > 0 {
+		end := len(buf) - len(msg) + g.hugeSize
+		for len(buf) < end {
+			buf = append(buf, ' ')
+			buf = append(buf, msg...)
+		}
+		buf = buf[:end]
+	}
+	buf = append(buf, g.content...)
+	buf = append(buf, g.newline...)
+
+	if g.utf16 {
+		line := string(buf[start:])
+		buf = appendUTF16(buf[:start], line)
+	}
+	return buf
+}
+
+func (g *Generator) write(l []byte) error {
+	if g.blockSize > 0 {
+		g.block = append(g.block, l...)
+		for len(g.block) >= g.blockSize {
+			if _, err := g.dest.Write(g.block[:g.blockSize]); err != nil {
+				return err
+			}
+			g.block = append(g.block[:0], g.block[g.blockSize:]...)
+		}
+		return nil
+	}
+
+	if g.splitParts > 1 {
+		n := (len(l) + g.splitParts - 1) / g.splitParts
+		for i := 0; i < len(l); i += n {
+			if i > 0 && g.splitDelay > 0 {
+				time.Sleep(g.splitDelay)
+			}
+			e := i + n
+			if e > len(l) {
+				e = len(l)
+			}
+			if _, err := g.dest.Write(l[i:e]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	_, err := g.dest.Write(l)
+	return err
+}
+
+// Stop stops the generator and returns once it wrote its last line.
 func (g *Generator) Stop() {
 	g.done <- struct{}{}
+	<-g.stopped
 }
 
 func (g *Generator) delay() time.Duration {
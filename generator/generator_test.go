@@ -0,0 +1,101 @@
+package generator
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	writes []string
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.writes = append(r.writes, string(b))
+	return len(b), nil
+}
+
+func (r *recorder) Hole(n int64) error {
+	r.writes = append(r.writes, fmt.Sprintf("hole %v", n))
+	return nil
+}
+
+func TestWriteModes(t *testing.T) {
+	cases := []struct {
+		opt      Opt
+		lines    []string
+		expected []string
+	}{
+		{OptSplitWrites(1, 0), []string{"abcdef\n"}, []string{"abcdef\n"}},
+		{OptSplitWrites(3, 0), []string{"abcdef\n"}, []string{"abc", "def", "\n"}},
+		{OptBlockBuffer(4), []string{"abc\n", "def\n", "gh\n"}, []string{"abc\n", "def\n"}},
+		{OptBlockBuffer(5), []string{"abc\n", "def\n", "gh\n"}, []string{"abc\nd", "ef\ngh"}},
+	}
+
+	for i, c := range cases {
+		r := &recorder{}
+		g := configure(r, c.opt)
+		for _, l := range c.lines {
+			if err := g.write([]byte(l)); err != nil {
+				t.Errorf("Case %v failed to write: %v", i, err)
+			}
+		}
+		if !reflect.DeepEqual(r.writes, c.expected) {
+			t.Errorf("Case %v expecting writes %q, got %q", i, c.expected, r.writes)
+		}
+	}
+}
+
+func TestPaddingAndHoles(t *testing.T) {
+	r := &recorder{}
+	g := configure(r, OptLines([]string{"abc"}), OptTimeLayout("-"), OptPadding(2, 3), OptHoles(3, 10))
+	for i := 0; i < 6; i++ {
+		if err := g.emit(time.Now()); err != nil {
+			t.Errorf("Failed to emit line: %v", err)
+		}
+	}
+	expected := []string{"- abc\n", "- abc\n", "\x00\x00\x00", "- abc\n", "hole 10", "- abc\n", "\x00\x00\x00", "- abc\n", "- abc\n", "\x00\x00\x00", "hole 10"}
+	if !reflect.DeepEqual(r.writes, expected) {
+		t.Errorf("Expecting writes %q, got %q", expected, r.writes)
+	}
+}
+
+func TestBackfillRotateSize(t *testing.T) {
+	r := &recorder{}
+	if err := Backfill(r, 10000, time.Hour, OptLines([]string{"abc"}), OptTimeLayout("-"), OptRotateSize(100)); err != nil {
+		t.Fatalf("Failed to backfill: %v", err)
+	}
+	var total int
+	for _, w := range r.writes {
+		if len(w) > 100 || len(w)%len("- abc\n") != 0 {
+			t.Errorf("Expecting writes of whole lines up to %v bytes, got %q", 100, w)
+		}
+		total += len(w)
+	}
+	if total < 10000 {
+		t.Errorf("Expecting at least %v bytes backfilled, got %v", 10000, total)
+	}
+}
+
+func TestContent(t *testing.T) {
+	cases := []struct {
+		opts     []Opt
+		expected []string
+	}{
+		{[]Opt{OptCRLF(), OptContent(ContentANSI)}, []string{"- abc " + contents[ContentANSI] + "\r\n", "- abc " + contents[ContentANSI] + "\r\n"}},
+		{[]Opt{OptHugeLines(2, 10)}, []string{"- abc\n", "- abc abc ab\n"}},
+		{[]Opt{OptUTF16()}, []string{"-\x00 \x00a\x00b\x00c\x00\n\x00", "-\x00 \x00a\x00b\x00c\x00\n\x00"}},
+	}
+
+	for i, c := range cases {
+		g := configure(nil, append(c.opts, OptLines([]string{"abc"}), OptTimeLayout("-"))...)
+		var lines []string
+		for range c.expected {
+			lines = append(lines, string(g.appendLine(nil, time.Now())))
+		}
+		if !reflect.DeepEqual(lines, c.expected) {
+			t.Errorf("Case %v expecting lines %q, got %q", i, c.expected, lines)
+		}
+	}
+}
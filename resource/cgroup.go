@@ -0,0 +1,367 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package resource
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cpuPeriod is the period in microseconds of the cpu.max limit
+const cpuPeriod = 100000
+
+// MemoryEvents counts the events of memory.events, Max counts the times the
+// memory limit was hit and OOMKill the processes killed by the OOM killer.
+type MemoryEvents struct {
+	Low, High, Max, OOM, OOMKill int64
+}
+
+func (a MemoryEvents) Sub(b MemoryEvents) MemoryEvents {
+	return MemoryEvents{a.Low - b.Low, a.High - b.High, a.Max - b.Max, a.OOM - b.OOM, a.OOMKill - b.OOMKill}
+}
+
+func (a MemoryEvents) String() string {
+	return fmt.Sprintf("low: %v high: %v max: %v oom: %v oom_kill: %v", a.Low, a.High, a.Max, a.OOM, a.OOMKill)
+}
+
+// CgroupIO holds the I/O counters of io.stat summed over all devices
+type CgroupIO struct {
+	RBytes, WBytes, RIOs, WIOs int64
+}
+
+func (a CgroupIO) Sub(b CgroupIO) CgroupIO {
+	return CgroupIO{a.RBytes - b.RBytes, a.WBytes - b.WBytes, a.RIOs - b.RIOs, a.WIOs - b.WIOs}
+}
+
+func (a CgroupIO) String() string {
+	return fmt.Sprintf("read: %v in %v ios, write: %v in %v ios", HumanSize(a.RBytes), a.RIOs, HumanSize(a.WBytes), a.WIOs)
+}
+
+// CgroupStats holds the usage of a cgroup v2 group from cpu.stat,
+// memory.current, memory.events and io.stat, the fields of controllers that
+// are not enabled for the group are zero.
+type CgroupStats struct {
+	CPUUsage, CPUUser, CPUSystem, Throttled time.Duration
+	Periods, ThrottledPeriods               int64
+	Memory                                  int64
+	MemoryEvents                            MemoryEvents
+	IO                                      CgroupIO
+}
+
+// Sub returns the usage between the stats b and a, Memory is the one of a
+func (a CgroupStats) Sub(b CgroupStats) CgroupStats {
+	return CgroupStats{
+		CPUUsage:         a.CPUUsage - b.CPUUsage,
+		CPUUser:          a.CPUUser - b.CPUUser,
+		CPUSystem:        a.CPUSystem - b.CPUSystem,
+		Throttled:        a.Throttled - b.Throttled,
+		Periods:          a.Periods - b.Periods,
+		ThrottledPeriods: a.ThrottledPeriods - b.ThrottledPeriods,
+		Memory:           a.Memory,
+		MemoryEvents:     a.MemoryEvents.Sub(b.MemoryEvents),
+		IO:               a.IO.Sub(b.IO),
+	}
+}
+
+// Cgroup is a cgroup v2 group
+type Cgroup struct {
+	path      string
+	dir       string
+	cpuMax    float64
+	memoryMax int64
+	// created is whether the group was created rather than existing already,
+	// saved are the limits of an existing group before they were set
+	created bool
+	saved   []limit
+}
+
+// limit is the value of a limit file of a group
+type limit struct {
+	file, value string
+}
+
+type CgroupOpt func(c *Cgroup)
+
+// OptCPUMax limits the group to cores cpus with cpu.max
+func OptCPUMax(cores float64) func(c *Cgroup) {
+	return func(c *Cgroup) {
+		c.cpuMax = cores
+	}
+}
+
+// OptMemoryMax limits the memory of the group to size bytes with memory.max
+func OptMemoryMax(size int64) func(c *Cgroup) {
+	return func(c *Cgroup) {
+		c.memoryMax = size
+	}
+}
+
+// NewCgroup creates the group at path relative to the cgroup v2 root, or uses
+// it if it exists, and sets its limits, the cpu, memory and io controllers are
+// enabled in the parent group when possible. The limits of an existing group
+// are restored by Remove.
+func NewCgroup(path string, opts ...CgroupOpt) (*Cgroup, error) {
+	return newCgroup(Cgroup2Mount(), path, opts...)
+}
+
+// newCgroup creates the group at path under the cgroup v2 hierarchy mounted at
+// mount.
+func newCgroup(mount, path string, opts ...CgroupOpt) (*Cgroup, error) {
+	c := &Cgroup{path: filepath.Clean("/" + path)}
+	c.dir = filepath.Join(mount, c.path)
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	err := os.Mkdir(c.dir, 0755)
+	if err != nil && !os.IsExist(err) {
+		return nil, fmt.Errorf("failed to create cgroup %v: %w", c.dir, err)
+	}
+	c.created = err == nil
+	// The controllers might already be enabled or not be available, setting
+	// the limits fails if they are needed but missing.
+	control := filepath.Join(filepath.Dir(c.dir), "cgroup.subtree_control")
+	for _, ctrl := range []string{"cpu", "memory", "io"} {
+		if err := ioutil.WriteFile(control, []byte("+"+ctrl), 0644); err != nil {
+			log.Printf("Unable to enable the %v controller in %v: %v", ctrl, control, err)
+		}
+	}
+
+	if c.cpuMax > 0 {
+		max := fmt.Sprintf("%v %v", int64(c.cpuMax*cpuPeriod), cpuPeriod)
+		if err := c.setLimit("cpu.max", max); err != nil {
+			c.Remove()
+			return nil, err
+		}
+	}
+	if c.memoryMax > 0 {
+		if err := c.setLimit("memory.max", strconv.FormatInt(c.memoryMax, 10)); err != nil {
+			c.Remove()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Path returns the path of the group relative to the cgroup v2 root
+func (c *Cgroup) Path() string {
+	return c.path
+}
+
+// ProcsFile returns the file processes are moved into the group with
+func (c *Cgroup) ProcsFile() string {
+	return filepath.Join(c.dir, "cgroup.procs")
+}
+
+// CPUMax returns the cpu limit of the group in cpus, 0 if unlimited
+func (c *Cgroup) CPUMax() float64 {
+	return c.cpuMax
+}
+
+// MemoryMax returns the memory limit of the group in bytes, 0 if unlimited
+func (c *Cgroup) MemoryMax() int64 {
+	return c.memoryMax
+}
+
+// Controllers returns the controllers enabled for the group
+func (c *Cgroup) Controllers() ([]string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(c.dir, "cgroup.controllers"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read controllers of cgroup %v: %w", c.dir, err)
+	}
+	return strings.Fields(string(b)), nil
+}
+
+// Created returns whether NewCgroup created the group, an existing one is used
+// otherwise.
+func (c *Cgroup) Created() bool {
+	return c.created
+}
+
+// Remove removes the group if NewCgroup created it, which fails while
+// processes are left in it. An existing group is kept with its limits
+// restored.
+func (c *Cgroup) Remove() error {
+	if !c.created {
+		var first error
+		for _, l := range c.saved {
+			if err := c.write(l.file, l.value); err != nil && first == nil {
+				first = err
+			}
+		}
+		c.saved = nil
+		return first
+	}
+	if err := os.Remove(c.dir); err != nil {
+		return fmt.Errorf("failed to remove cgroup %v: %w", c.dir, err)
+	}
+	return nil
+}
+
+// setLimit writes value to the limit file, the value of an existing group is
+// saved first so Remove can restore it.
+func (c *Cgroup) setLimit(file, value string) error {
+	if !c.created {
+		b, err := ioutil.ReadFile(filepath.Join(c.dir, file))
+		if err != nil {
+			return fmt.Errorf("failed to read %v of cgroup %v: %w", file, c.dir, err)
+		}
+		c.saved = append(c.saved, limit{file, strings.TrimSpace(string(b))})
+	}
+	return c.write(file, value)
+}
+
+func (c *Cgroup) write(file, value string) error {
+	if err := ioutil.WriteFile(filepath.Join(c.dir, file), []byte(value), 0644); err != nil {
+		return fmt.Errorf("failed to set %v of cgroup %v to %v: %w", file, c.dir, value, err)
+	}
+	return nil
+}
+
+// Stats reads the usage of the group
+func (c *Cgroup) Stats() (CgroupStats, error) {
+	var s CgroupStats
+	var usage, user, system, throttled int64
+	err := c.readKeyed("cpu.stat", map[string]*int64{
+		"usage_usec":     &usage,
+		"user_usec":      &user,
+		"system_usec":    &system,
+		"throttled_usec": &throttled,
+		"nr_periods":     &s.Periods,
+		"nr_throttled":   &s.ThrottledPeriods,
+	})
+	if err != nil {
+		return s, err
+	}
+	s.CPUUsage = time.Duration(usage) * time.Microsecond
+	s.CPUUser = time.Duration(user) * time.Microsecond
+	s.CPUSystem = time.Duration(system) * time.Microsecond
+	s.Throttled = time.Duration(throttled) * time.Microsecond
+
+	// The files of the memory and io controllers only exist when enabled
+	b, err := ioutil.ReadFile(filepath.Join(c.dir, "memory.current"))
+	if err == nil {
+		s.Memory, err = strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return s, fmt.Errorf("failed to read memory.current of cgroup %v: %w", c.dir, err)
+	}
+	err = c.readKeyed("memory.events", map[string]*int64{
+		"low":      &s.MemoryEvents.Low,
+		"high":     &s.MemoryEvents.High,
+		"max":      &s.MemoryEvents.Max,
+		"oom":      &s.MemoryEvents.OOM,
+		"oom_kill": &s.MemoryEvents.OOMKill,
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return s, err
+	}
+	s.IO, err = c.readIO()
+	if err != nil && !os.IsNotExist(err) {
+		return s, err
+	}
+	return s, nil
+}
+
+// readKeyed reads a file of "key value" lines into the fields given
+func (c *Cgroup) readKeyed(file string, fields map[string]*int64) error {
+	f, err := os.Open(filepath.Join(c.dir, file))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fs := strings.Fields(sc.Text())
+		if len(fs) != 2 {
+			continue
+		}
+		v, ok := fields[fs[0]]
+		if !ok {
+			continue
+		}
+		*v, err = strconv.ParseInt(fs[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse %v of %v of cgroup %v: %w", fs[0], file, c.dir, err)
+		}
+	}
+	return sc.Err()
+}
+
+// readIO reads io.stat, its lines are a device followed by key=value pairs
+func (c *Cgroup) readIO() (CgroupIO, error) {
+	var io CgroupIO
+	b, err := ioutil.ReadFile(filepath.Join(c.dir, "io.stat"))
+	if err != nil {
+		return io, err
+	}
+
+	fields := map[string]*int64{
+		"rbytes": &io.RBytes,
+		"wbytes": &io.WBytes,
+		"rios":   &io.RIOs,
+		"wios":   &io.WIOs,
+	}
+	for _, l := range strings.Split(string(b), "\n") {
+		fs := strings.Fields(l)
+		if len(fs) < 2 {
+			continue
+		}
+		for _, kv := range fs[1:] {
+			ps := strings.SplitN(kv, "=", 2)
+			if len(ps) != 2 {
+				continue
+			}
+			f, ok := fields[ps[0]]
+			if !ok {
+				continue
+			}
+			v, err := strconv.ParseInt(ps[1], 10, 64)
+			if err != nil {
+				return io, fmt.Errorf("failed to parse %v of io.stat of cgroup %v: %w", ps[0], c.dir, err)
+			}
+			*f += v
+		}
+	}
+	return io, nil
+}
+
+// Cgroup2Mount returns where the cgroup v2 hierarchy is mounted, which is
+// below CgroupRoot on hosts with both cgroup versions.
+func Cgroup2Mount() string {
+	b, err := ioutil.ReadFile("/proc/self/mounts")
+	if err != nil {
+		return CgroupRoot
+	}
+	for _, l := range strings.Split(string(b), "\n") {
+		// Lines are device mountpoint fstype options ...
+		fs := strings.Fields(l)
+		if len(fs) > 2 && fs[2] == "cgroup2" {
+			return fs[1]
+		}
+	}
+	return CgroupRoot
+}
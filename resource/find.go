@@ -0,0 +1,250 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package resource
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CgroupRoot is where the cgroup hierarchy is mounted
+const CgroupRoot = "/sys/fs/cgroup"
+
+// Matcher selects processes by pid
+type Matcher func(pid int) bool
+
+// commLen is the length that command names are truncated to in /proc/<pid>/comm
+const commLen = 15
+
+// MatchName matches processes with the command name, as in /proc/<pid>/comm.
+// Names longer than comm are matched by their first 15 bytes, and by the name
+// of the executable if comm was taken from it, scripts have the name of the
+// script in comm but the one of the interpreter in exe.
+func MatchName(name string) Matcher {
+	return func(pid int) bool {
+		b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%v/comm", pid))
+		if err != nil {
+			return false
+		}
+		exe, _ := os.Readlink(fmt.Sprintf("/proc/%v/exe", pid))
+		return matchName(name, strings.TrimSpace(string(b)), exe)
+	}
+}
+
+// matchName tells if comm and exe, which is empty if unreadable, are of a
+// process named name.
+func matchName(name, comm, exe string) bool {
+	if len(name) <= commLen || comm != name[:commLen] {
+		return comm == name
+	}
+	base := path.Base(strings.TrimSuffix(exe, " (deleted)"))
+	return !strings.HasPrefix(base, comm) || base == name
+}
+
+// MatchCmdline matches processes with a command line, its arguments joined by
+// spaces, that matches re.
+func MatchCmdline(re *regexp.Regexp) Matcher {
+	return func(pid int) bool {
+		cmdline := readCmdline(pid)
+		return cmdline != "" && re.MatchString(cmdline)
+	}
+}
+
+// MatchCgroup matches processes in the cgroup or its descendants, the path is
+// relative to the cgroup root, e.g. /system.slice/app.service, or a path
+// under the mount of the cgroup hierarchy.
+func MatchCgroup(cgroup string) Matcher {
+	cgroup = cgroupPath(cgroup, Cgroup2Mount())
+	return func(pid int) bool {
+		return inCgroup(readCgroups(pid), cgroup)
+	}
+}
+
+// cgroupPath returns the path of cgroup relative to the cgroup root, cgroup
+// is either relative already or a path under mount or CgroupRoot.
+func cgroupPath(cgroup, mount string) string {
+	cgroup = path.Clean("/" + cgroup)
+	for _, m := range []string{mount, CgroupRoot} {
+		if cgroup == m || strings.HasPrefix(cgroup, m+"/") {
+			return path.Clean("/" + strings.TrimPrefix(cgroup, m))
+		}
+	}
+	return cgroup
+}
+
+// inCgroup tells if any of the cgroup paths cgs is cgroup or a descendant
+func inCgroup(cgs []string, cgroup string) bool {
+	for _, cg := range cgs {
+		if cg == cgroup || cgroup == "/" || strings.HasPrefix(cg, cgroup+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// unitTypes are the types of systemd units that can have processes
+var unitTypes = []string{".service", ".scope", ".slice", ".socket", ".mount", ".swap"}
+
+// MatchUnit matches processes of the systemd unit, the unit is a service if
+// no type is given.
+func MatchUnit(unit string) Matcher {
+	unit = unitName(unit)
+	return func(pid int) bool {
+		return inUnit(readCgroups(pid), unit)
+	}
+}
+
+// unitName returns the name of unit with its type, which is service if
+// unit has none of unitTypes.
+func unitName(unit string) string {
+	for _, t := range unitTypes {
+		if strings.HasSuffix(unit, t) {
+			return unit
+		}
+	}
+	return unit + ".service"
+}
+
+// inUnit tells if any of the cgroup paths cgs is in the cgroup of the unit
+// or one of its descendants.
+func inUnit(cgs []string, unit string) bool {
+	for _, cg := range cgs {
+		for ; cg != "/" && cg != "." && cg != ""; cg = path.Dir(cg) {
+			if path.Base(cg) == unit {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FindRoot returns the oldest process matched that does not descend from
+// another matched process, which is the main process of a service or
+// container. logbench, its ancestors, e.g. the shell or sudo it is run with,
+// and its descendants, e.g. the agent it launches, are never matched.
+func FindRoot(match Matcher) (int, error) {
+	pids, err := allPids()
+	if err != nil {
+		return 0, err
+	}
+
+	ppids := make(map[int]int)
+	starts := make(map[int]int)
+	var alive []int
+	for _, pid := range pids {
+		ppid, start, err := readParent(pid)
+		if err != nil {
+			// The process might have exited since /proc was read
+			continue
+		}
+		ppids[pid], starts[pid] = ppid, start
+		alive = append(alive, pid)
+	}
+
+	self := os.Getpid()
+	related := map[int]bool{self: true}
+	for ppid := ppids[self]; ppid > 0 && !related[ppid]; ppid = ppids[ppid] {
+		related[ppid] = true
+	}
+	var matched []int
+	for _, pid := range alive {
+		if !related[pid] && !descendsFrom(pid, self, ppids) && match(pid) {
+			matched = append(matched, pid)
+		}
+	}
+
+	isMatched := make(map[int]bool)
+	for _, pid := range matched {
+		isMatched[pid] = true
+	}
+	root := 0
+	for _, pid := range matched {
+		descends := false
+		for ppid := ppids[pid]; ppid > 1 && !descends; ppid = ppids[ppid] {
+			descends = isMatched[ppid]
+		}
+		if descends {
+			continue
+		}
+		if root == 0 || starts[pid] < starts[root] || (starts[pid] == starts[root] && pid < root) {
+			root = pid
+		}
+	}
+	if root == 0 {
+		return 0, fmt.Errorf("no matching process found")
+	}
+	return root, nil
+}
+
+// descendsFrom tells if pid is a descendant of ancestor given the parents ppids
+func descendsFrom(pid, ancestor int, ppids map[int]int) bool {
+	for ppid := ppids[pid]; ppid > 0; ppid = ppids[ppid] {
+		if ppid == ancestor {
+			return true
+		}
+		if ppid == 1 {
+			break
+		}
+	}
+	return false
+}
+
+// readParent reads the parent pid and the start time in clock ticks after
+// boot of the process pid.
+func readParent(pid int) (int, int, error) {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%v/stat", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	_, fs := parseStat(string(b))
+	if len(fs) < 20 {
+		return 0, 0, fmt.Errorf("malformed stat of process %v", pid)
+	}
+	ppid, err := strconv.Atoi(fs[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	start, err := strconv.Atoi(fs[19])
+	if err != nil {
+		return 0, 0, err
+	}
+	return ppid, start, nil
+}
+
+// readCgroups reads the cgroup paths of the process pid in every hierarchy
+func readCgroups(pid int) []string {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%v/cgroup", pid))
+	if err != nil {
+		return nil
+	}
+
+	var cgs []string
+	for _, l := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		// Lines are hierarchy-ID:controller-list:cgroup-path
+		fs := strings.SplitN(l, ":", 3)
+		if len(fs) == 3 {
+			cgs = append(cgs, fs[2])
+		}
+	}
+	return cgs
+}
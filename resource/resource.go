@@ -26,6 +26,7 @@ import (
 	"os/exec"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -55,7 +56,106 @@ func getconf(conf string) int {
 type res struct {
 	t time.Time
 
+	comm                                          string
 	utime, stime, cutime, cstime, rss, text, data int
+	io                                            IO
+	fds                                           FDs
+	threads                                       int
+	smaps                                         Smaps
+	// ctxt are the context switches by tid, /proc/<pid>/status only has
+	// those of the thread group leader
+	ctxt map[int]ctxtSwitches
+	// tasks are the threads by tid, only read when threads are tracked
+	tasks map[int]task
+	// errs are the errors reading details by detail
+	errs map[string]error
+}
+
+// Details of a process that can be restricted, e.g. the I/O counters and
+// descriptors of processes of other users without CAP_SYS_PTRACE.
+const (
+	DetailIO     = "io"
+	DetailFDs    = "fds"
+	DetailStatus = "status"
+	DetailSmaps  = "smaps"
+)
+
+type ctxtSwitches struct {
+	v, nv int64
+}
+
+type task struct {
+	name    string
+	jiffies int
+}
+
+// ProcessUsage is the resource usage of a single process of the tree, CPU is
+// the percentage used since the previous update and Memory the RSS.
+type ProcessUsage struct {
+	Pid           int
+	Comm, Cmdline string
+	CPU           float64
+	Memory        int
+	PSS           int64
+}
+
+// ThreadUsage is the resource usage of the threads with the same name over
+// the process tree.
+type ThreadUsage struct {
+	Name  string
+	Count int
+	CPU   float64
+}
+
+// Smaps holds the memory usage from /proc/<pid>/smaps_rollup in bytes. PSS
+// divides shared pages between the processes sharing them and USS counts only
+// private pages, so neither double counts pages shared by the agent's
+// processes like RSS does. File is the resident file backed and shared
+// memory.
+type Smaps struct {
+	RSS, PSS, USS, Anon, File, Swap int64
+}
+
+func (a Smaps) Add(b Smaps) Smaps {
+	return Smaps{a.RSS + b.RSS, a.PSS + b.PSS, a.USS + b.USS, a.Anon + b.Anon, a.File + b.File, a.Swap + b.Swap}
+}
+
+// FDs counts open file descriptors by what they refer to, Deleted counts
+// files that were deleted while open and Other anonymous inodes like epoll.
+type FDs struct {
+	Files, Deleted, Sockets, Pipes, Inotify, Other int
+}
+
+func (a FDs) Add(b FDs) FDs {
+	return FDs{a.Files + b.Files, a.Deleted + b.Deleted, a.Sockets + b.Sockets, a.Pipes + b.Pipes, a.Inotify + b.Inotify, a.Other + b.Other}
+}
+
+func (a FDs) Total() int {
+	return a.Files + a.Deleted + a.Sockets + a.Pipes + a.Inotify + a.Other
+}
+
+func (a FDs) String() string {
+	return fmt.Sprintf("%v (files: %v deleted: %v sockets: %v pipes: %v inotify: %v other: %v)", a.Total(), a.Files, a.Deleted, a.Sockets, a.Pipes, a.Inotify, a.Other)
+}
+
+// IO holds the I/O counters of /proc/<pid>/io, ReadBytes and WriteBytes
+// count storage I/O while RChar and WChar include reads served from the page
+// cache and sockets.
+type IO struct {
+	RChar, WChar, SyscR, SyscW, ReadBytes, WriteBytes int64
+}
+
+func (a IO) Add(b IO) IO {
+	return IO{a.RChar + b.RChar, a.WChar + b.WChar, a.SyscR + b.SyscR, a.SyscW + b.SyscW, a.ReadBytes + b.ReadBytes, a.WriteBytes + b.WriteBytes}
+}
+
+func (a IO) Sub(b IO) IO {
+	return IO{a.RChar - b.RChar, a.WChar - b.WChar, a.SyscR - b.SyscR, a.SyscW - b.SyscW, a.ReadBytes - b.ReadBytes, a.WriteBytes - b.WriteBytes}
+}
+
+func (a IO) String() string {
+	return fmt.Sprintf("rchar: %v wchar: %v syscr: %v syscw: %v read_bytes: %v write_bytes: %v",
+		humanSize(int(a.RChar)), humanSize(int(a.WChar)), a.SyscR, a.SyscW, humanSize(int(a.ReadBytes)), humanSize(int(a.WriteBytes)))
 }
 
 type Process struct {
@@ -63,10 +163,12 @@ type Process struct {
 	prev, curr res
 	children   []*Process
 	prevPs     map[int]*Process
+	// threads enables reading the threads of the processes
+	threads bool
 }
 
 func FindProcess(pid int) (*Process, error) {
-	ps, err := allProcesses()
+	ps, err := processTree(pid)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve process map: %w", err)
 	}
@@ -75,13 +177,26 @@ func FindProcess(pid int) (*Process, error) {
 	if !ok {
 		return nil, fmt.Errorf("process with pid %v not found", pid)
 	}
+	p.readDetails(false)
 	p.prevPs = ps
 
 	return p, nil
 }
 
+// Pid returns the pid of the process
+func (p Process) Pid() int {
+	return p.pid
+}
+
+// TrackThreads enables reading the usage of every thread on updates, which
+// ThreadBreakdown reports.
+func (p *Process) TrackThreads() {
+	p.threads = true
+}
+
+// Update reads the resource usage of the process and its descendants again
 func (p *Process) Update() error {
-	ps, err := allProcesses()
+	ps, err := processTree(p.pid)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve process map: %w", err)
 	}
@@ -97,19 +212,80 @@ func (p *Process) Update() error {
 	if !ok {
 		return fmt.Errorf("process with pid %v no longer exist", p.pid)
 	}
+	threads := p.threads
+	np.readDetails(threads)
 	*p = *np
+	p.threads = threads
 	p.prevPs = ps
 	return nil
 }
 
 func (p *Process) CpuPercent() float64 {
+	return p.cpuPercent(p.allCurrJiffies() - p.allPrevJiffies())
+}
+
+// cpuPercent returns the cpu usage of dj jiffies used since the previous update
+func (p *Process) cpuPercent(dj int) float64 {
 	if p.prev.t.IsZero() || p.curr.t.IsZero() {
 		return 0
 	}
 
-	dj := float64(p.allCurrJiffies() - p.allPrevJiffies())
 	dt := float64(p.curr.t.Sub(p.prev.t)) / float64(time.Second)
-	return dj / (dt * hz) * 100
+	return float64(dj) / (dt * hz) * 100
+}
+
+// Breakdown returns the resource usage of the process and each of its
+// descendants.
+func (p *Process) Breakdown() []ProcessUsage {
+	var us []ProcessUsage
+	p.breakdown(p, &us)
+	return us
+}
+
+// breakdown appends the usage of the tree of p, the cpu usage is over the
+// interval of the root like in CpuPercent so new processes are included.
+func (p *Process) breakdown(root *Process, us *[]ProcessUsage) {
+	*us = append(*us, ProcessUsage{
+		Pid:     p.pid,
+		Comm:    p.curr.comm,
+		Cmdline: readCmdline(p.pid),
+		CPU:     root.cpuPercent(p.curr.CpuJiffies() - p.prev.CpuJiffies()),
+		Memory:  p.curr.Memory(),
+		PSS:     p.curr.smaps.PSS,
+	})
+	for _, child := range p.children {
+		child.breakdown(root, us)
+	}
+}
+
+// ThreadBreakdown returns the resource usage of the threads of the process
+// tree by thread name, TrackThreads has to be called before.
+func (p *Process) ThreadBreakdown() []ThreadUsage {
+	byName := make(map[string]*ThreadUsage)
+	var us []*ThreadUsage
+	p.threadBreakdown(p, byName, &us)
+
+	result := make([]ThreadUsage, len(us))
+	for i, u := range us {
+		result[i] = *u
+	}
+	return result
+}
+
+func (p *Process) threadBreakdown(root *Process, byName map[string]*ThreadUsage, us *[]*ThreadUsage) {
+	for tid, t := range p.curr.tasks {
+		u, ok := byName[t.name]
+		if !ok {
+			u = &ThreadUsage{Name: t.name}
+			byName[t.name] = u
+			*us = append(*us, u)
+		}
+		u.Count++
+		u.CPU += root.cpuPercent(t.jiffies - p.prev.tasks[tid].jiffies)
+	}
+	for _, child := range p.children {
+		child.threadBreakdown(root, byName, us)
+	}
 }
 
 func (p *Process) allCurrJiffies() int {
@@ -128,6 +304,122 @@ func (p *Process) allPrevJiffies() int {
 	return j
 }
 
+// IO returns the I/O counters of the process and its children since they
+// were started.
+func (p Process) IO() IO {
+	io := p.curr.io
+	for _, child := range p.children {
+		io = io.Add(child.IO())
+	}
+	return io
+}
+
+// IODelta returns the I/O of the process and its children since the
+// previous update.
+func (p Process) IODelta() IO {
+	io := p.curr.io.Sub(p.prev.io)
+	for _, child := range p.children {
+		io = io.Add(child.IODelta())
+	}
+	return io
+}
+
+// FDs returns the open file descriptors of the process and its children
+func (p Process) FDs() FDs {
+	fds := p.curr.fds
+	for _, child := range p.children {
+		fds = fds.Add(child.FDs())
+	}
+	return fds
+}
+
+// Threads returns the number of threads of the process and its children
+func (p Process) Threads() int {
+	n := p.curr.threads
+	for _, child := range p.children {
+		n += child.Threads()
+	}
+	return n
+}
+
+// CtxtSwitchesDelta returns the voluntary and involuntary context switches of
+// the process and its children since the previous update.
+func (p Process) CtxtSwitchesDelta() (int64, int64) {
+	// Threads started since the previous update count from zero, threads
+	// that exited meanwhile drop out
+	var v, nv int64
+	for tid, c := range p.curr.ctxt {
+		pc := p.prev.ctxt[tid]
+		v += c.v - pc.v
+		nv += c.nv - pc.nv
+	}
+	for _, child := range p.children {
+		cv, cnv := child.CtxtSwitchesDelta()
+		v += cv
+		nv += cnv
+	}
+	return v, nv
+}
+
+// Smaps returns the memory usage of the process and its children from
+// smaps_rollup.
+func (p Process) Smaps() Smaps {
+	s := p.curr.smaps
+	for _, child := range p.children {
+		s = s.Add(child.Smaps())
+	}
+	return s
+}
+
+// readDetails reads the I/O counters, descriptors, status, memory usage and
+// optionally the threads of the process tree, they are only read for the
+// monitored processes as reading them is restricted and costly.
+func (p *Process) readDetails(threads bool) {
+	var err error
+	p.curr.errs = make(map[string]error)
+	p.curr.io, err = readIO(p.pid)
+	p.detailErr(DetailIO, err)
+	p.curr.fds, err = readFDs(p.pid)
+	p.detailErr(DetailFDs, err)
+	p.detailErr(DetailStatus, readStatus(p.pid, &p.curr))
+	p.curr.smaps, err = readSmaps(p.pid)
+	p.detailErr(DetailSmaps, err)
+	if threads {
+		p.curr.tasks = readTasks(p.pid)
+	}
+	for _, child := range p.children {
+		child.readDetails(threads)
+	}
+}
+
+// detailErr records the error reading detail, unless the process exited
+// since the last update, which the next update reports.
+func (p *Process) detailErr(detail string, err error) {
+	if err != nil && !os.IsNotExist(err) && !errors.Is(err, syscall.ESRCH) {
+		p.curr.errs[detail] = err
+	}
+}
+
+// Unavailable returns the details that could not be read for the process or
+// any of its children by the last update, with the first error of each.
+// Their values are incomplete and should be left out.
+func (p Process) Unavailable() map[string]error {
+	errs := make(map[string]error)
+	p.unavailable(errs)
+	return errs
+}
+
+func (p Process) unavailable(errs map[string]error) {
+	for d, err := range p.curr.errs {
+		if _, ok := errs[d]; !ok {
+			errs[d] = err
+		}
+	}
+	for _, child := range p.children {
+		child.unavailable(errs)
+	}
+}
+
 func (p Process) Memory() int {
 	m := p.curr.Memory()
 	for _, child := range p.children {
@@ -164,6 +456,362 @@ func (p Process) DataMemoryHuman() string {
 	return humanSize(p.DataMemory())
 }
 
+// FileOffsets returns the largest offset in every file opened by the process
+// and its children, by path.
+func (p Process) FileOffsets() map[string]int64 {
+	offsets := make(map[string]int64)
+	p.fileOffsets(offsets)
+	return offsets
+}
+
+func (p Process) fileOffsets(offsets map[string]int64) {
+	// The process might have exited since the last update
+	readFileOffsets(p.pid, offsets)
+	for _, child := range p.children {
+		child.fileOffsets(offsets)
+	}
+}
+
+func readFileOffsets(pid int, offsets map[string]int64) error {
+	dir := fmt.Sprintf("/proc/%v/fd", pid)
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	fds, err := d.Readdirnames(0)
+	d.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, fd := range fds {
+		path, err := os.Readlink(dir + "/" + fd)
+		if err != nil || !strings.HasPrefix(path, "/") {
+			continue
+		}
+		b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%v/fdinfo/%v", pid, fd))
+		if err != nil {
+			continue
+		}
+		for _, l := range strings.Split(string(b), "\n") {
+			if !strings.HasPrefix(l, "pos:") {
+				continue
+			}
+			pos, err := strconv.ParseInt(strings.TrimSpace(l[len("pos:"):]), 10, 64)
+			if err == nil && pos > offsets[path] {
+				offsets[path] = pos
+			}
+			break
+		}
+	}
+	return nil
+}
+
+func readIO(pid int) (IO, error) {
+	var io IO
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%v/io", pid))
+	if err != nil {
+		return io, err
+	}
+	fields := map[string]*int64{
+		"rchar":       &io.RChar,
+		"wchar":       &io.WChar,
+		"syscr":       &io.SyscR,
+		"syscw":       &io.SyscW,
+		"read_bytes":  &io.ReadBytes,
+		"write_bytes": &io.WriteBytes,
+	}
+	for _, l := range strings.Split(string(b), "\n") {
+		kv := strings.SplitN(l, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		f, ok := fields[kv[0]]
+		if !ok {
+			continue
+		}
+		*f, err = strconv.ParseInt(strings.TrimSpace(kv[1]), 10, 64)
+		if err != nil {
+			return io, fmt.Errorf("failed to parse %v of process %v: %w", kv[0], pid, err)
+		}
+	}
+	return io, nil
+}
+
+// readTasks reads the name and cpu usage of the threads of the process pid
+func readTasks(pid int) map[int]task {
+	tasks := make(map[int]task)
+	dir := fmt.Sprintf("/proc/%v/task", pid)
+	d, err := os.Open(dir)
+	if err != nil {
+		return tasks
+	}
+	tids, err := d.Readdirnames(0)
+	d.Close()
+	if err != nil {
+		return tasks
+	}
+
+	for _, s := range tids {
+		tid, err := strconv.Atoi(s)
+		if err != nil {
+			continue
+		}
+		// The thread might have exited since the directory was read
+		b, err := ioutil.ReadFile(dir + "/" + s + "/stat")
+		if err != nil {
+			continue
+		}
+		comm, fs := parseStat(string(b))
+		if len(fs) < 13 {
+			continue
+		}
+		utime, _ := strconv.Atoi(fs[11])
+		stime, _ := strconv.Atoi(fs[12])
+		tasks[tid] = task{name: comm, jiffies: utime + stime}
+	}
+	return tasks
+}
+
+func readCmdline(pid int) string {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%v/cmdline", pid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.Replace(string(b), "\x00", " ", -1))
+}
+
+func readFDs(pid int) (FDs, error) {
+	var fds FDs
+	dir := fmt.Sprintf("/proc/%v/fd", pid)
+	d, err := os.Open(dir)
+	if err != nil {
+		return fds, err
+	}
+	names, err := d.Readdirnames(0)
+	d.Close()
+	if err != nil {
+		return fds, err
+	}
+
+	for _, fd := range names {
+		path, err := os.Readlink(dir + "/" + fd)
+		if err != nil {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(path, " (deleted)"):
+			fds.Deleted++
+		case strings.HasPrefix(path, "/"):
+			fds.Files++
+		case strings.HasPrefix(path, "socket:"):
+			fds.Sockets++
+		case strings.HasPrefix(path, "pipe:"):
+			fds.Pipes++
+		case path == "anon_inode:inotify":
+			fds.Inotify++
+		default:
+			fds.Other++
+		}
+	}
+	return fds, nil
+}
+
+// readStatus reads the thread count from /proc/<pid>/status and the context
+// switches of every thread from /proc/<pid>/task/<tid>/status
+func readStatus(pid int, r *res) error {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%v/status", pid))
+	if err != nil {
+		return err
+	}
+	for _, l := range strings.Split(string(b), "\n") {
+		kv := strings.SplitN(l, ":", 2)
+		if len(kv) == 2 && kv[0] == "Threads" {
+			r.threads, err = strconv.Atoi(strings.TrimSpace(kv[1]))
+			if err != nil {
+				return fmt.Errorf("failed to parse %v of process %v: %w", kv[0], pid, err)
+			}
+		}
+	}
+
+	dir := fmt.Sprintf("/proc/%v/task", pid)
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	tids, err := d.Readdirnames(0)
+	d.Close()
+	if err != nil {
+		return err
+	}
+	r.ctxt = make(map[int]ctxtSwitches)
+	for _, s := range tids {
+		tid, err := strconv.Atoi(s)
+		if err != nil {
+			continue
+		}
+		// The thread might have exited since the directory was read
+		b, err := ioutil.ReadFile(dir + "/" + s + "/status")
+		if os.IsNotExist(err) || errors.Is(err, syscall.ESRCH) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var c ctxtSwitches
+		for _, l := range strings.Split(string(b), "\n") {
+			kv := strings.SplitN(l, ":", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			v := strings.TrimSpace(kv[1])
+			switch kv[0] {
+			case "voluntary_ctxt_switches":
+				c.v, err = strconv.ParseInt(v, 10, 64)
+			case "nonvoluntary_ctxt_switches":
+				c.nv, err = strconv.ParseInt(v, 10, 64)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to parse %v of thread %v: %w", kv[0], tid, err)
+			}
+		}
+		r.ctxt[tid] = c
+	}
+	return nil
+}
+
+func readSmaps(pid int) (Smaps, error) {
+	var s Smaps
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%v/smaps_rollup", pid))
+	if err != nil {
+		return s, err
+	}
+
+	var privateClean, privateDirty int64
+	fields := map[string]*int64{
+		"Rss":           &s.RSS,
+		"Pss":           &s.PSS,
+		"Private_Clean": &privateClean,
+		"Private_Dirty": &privateDirty,
+		"Anonymous":     &s.Anon,
+		"Swap":          &s.Swap,
+	}
+	for _, l := range strings.Split(string(b), "\n") {
+		fs := strings.Fields(l)
+		if len(fs) != 3 || fs[2] != "kB" {
+			continue
+		}
+		f, ok := fields[strings.TrimSuffix(fs[0], ":")]
+		if !ok {
+			continue
+		}
+		kb, err := strconv.ParseInt(fs[1], 10, 64)
+		if err != nil {
+			return s, fmt.Errorf("failed to parse %v of process %v: %w", fs[0], pid, err)
+		}
+		*f = kb * 1024
+	}
+	s.USS = privateClean + privateDirty
+	s.File = s.RSS - s.Anon
+	return s, nil
+}
+
+// hasChildren tells whether the kernel lists the children of tasks in
+// /proc/<pid>/task/<tid>/children
+var hasChildren = func() bool {
+	pid := os.Getpid()
+	_, err := os.Stat(fmt.Sprintf("/proc/%v/task/%v/children", pid, pid))
+	return err == nil
+}()
+
+// processTree returns the process pid and its descendants by pid, found
+// through the children of their tasks so only the monitored processes are
+// read instead of every process on the host. Without the children files all
+// processes are read.
+func processTree(pid int) (map[int]*Process, error) {
+	if !hasChildren {
+		ps, err := allProcesses()
+		if err != nil {
+			return nil, err
+		}
+		// Keep the previous samples of the tree only
+		tree := make(map[int]*Process)
+		if p, ok := ps[pid]; ok {
+			p.addTo(tree)
+		}
+		return tree, nil
+	}
+
+	ps := make(map[int]*Process)
+	root, err := findProcess(pid)
+	if errors.Is(err, os.ErrNotExist) {
+		return ps, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read process %v with error: %w", pid, err)
+	}
+	ps[pid] = root
+
+	queue := []*Process{root}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		// The process might have exited since it was read
+		cpids, _ := childPids(p.pid)
+		for _, cpid := range cpids {
+			if _, ok := ps[cpid]; ok {
+				continue
+			}
+			c, err := findProcess(cpid)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read process %v with error: %w", cpid, err)
+			}
+			ps[cpid] = c
+			p.children = append(p.children, c)
+			queue = append(queue, c)
+		}
+	}
+	return ps, nil
+}
+
+func (p *Process) addTo(ps map[int]*Process) {
+	ps[p.pid] = p
+	for _, child := range p.children {
+		child.addTo(ps)
+	}
+}
+
+// childPids returns the children of all tasks of the process pid
+func childPids(pid int) ([]int, error) {
+	dir := fmt.Sprintf("/proc/%v/task", pid)
+	d, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	tids, err := d.Readdirnames(0)
+	d.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+	for _, tid := range tids {
+		b, err := ioutil.ReadFile(dir + "/" + tid + "/children")
+		if err != nil {
+			continue
+		}
+		for _, f := range strings.Fields(string(b)) {
+			if cpid, err := strconv.Atoi(f); err == nil {
+				pids = append(pids, cpid)
+			}
+		}
+	}
+	return pids, nil
+}
+
 func allPids() ([]int, error) {
 	proc, err := os.Open("/proc")
 	if err != nil {
@@ -229,6 +877,11 @@ func findProcess(pid int) (*Process, error) {
 
 var units = []string{"", "KB", "MB", "GB", "TB", "PB", "EB"}
 
+// HumanSize formats a number of bytes with a unit, e.g. 12MB
+func HumanSize(s int64) string {
+	return humanSize(int(s))
+}
+
 func humanSize(s int) string {
 	var ui = 0
 	for s > 10000 && ui < len(units)-1 {
@@ -261,9 +914,11 @@ func readProcess(pid int) (res, int, error) {
 	if err != nil {
 		return r, 0, err
 	}
-	s := string(b)
-	si := strings.LastIndex(s, ")")
-	fs := strings.Fields(s[si+1:])
+	comm, fs := parseStat(string(b))
+	r.comm = comm
+	if len(fs) < 15 {
+		return r, 0, fmt.Errorf("malformed stat of process %v", pid)
+	}
 
 	// Note: index+3 of fs matches the field number in the kernel doc:
 	// https://man7.org/linux/man-pages/man5/proc.5.html
@@ -294,8 +949,7 @@ func readProcess(pid int) (res, int, error) {
 	if err != nil {
 		return r, ppid, err
 	}
-	s = string(b)
-	fs = strings.Fields(s)
+	fs = strings.Fields(string(b))
 
 	r.rss, err = strconv.Atoi(fs[1])
 	if err != nil {
@@ -313,3 +967,17 @@ func readProcess(pid int) (res, int, error) {
 	}
 	return r, ppid, nil
 }
+
+// parseStat returns the command name and the fields after it of a stat file,
+// the name is in parentheses and can contain spaces.
+func parseStat(s string) (string, []string) {
+	si := strings.LastIndex(s, ")")
+	if si < 0 {
+		return "", nil
+	}
+	var comm string
+	if ci := strings.Index(s, "("); ci >= 0 && ci < si {
+		comm = s[ci+1 : si]
+	}
+	return comm, strings.Fields(s[si+1:])
+}
@@ -0,0 +1,427 @@
+package resource
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestProcessTree(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start child process: %v", err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	p, err := FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("Failed to find process: %v", err)
+	}
+	if err := p.Update(); err != nil {
+		t.Fatalf("Failed to update process: %v", err)
+	}
+
+	var found bool
+	for _, child := range p.children {
+		if child.pid == cmd.Process.Pid {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expecting child %v in the children of %v, got %v", cmd.Process.Pid, p.pid, p.children)
+	}
+	if p.Threads() < 2 {
+		t.Errorf("Expecting threads of the process and its child, got %v", p.Threads())
+	}
+}
+
+// BenchmarkSampling compares sampling the test process and its descendants,
+// which is how processes are sampled, with reading every process on the host,
+// which is how they were sampled before. The difference grows with the number
+// of processes on the host, so both are run together on the same host, e.g.
+// go test -run NONE -bench Sampling ./resource
+func BenchmarkSampling(b *testing.B) {
+	b.Run("descendants", func(b *testing.B) {
+		p, err := FindProcess(os.Getpid())
+		if err != nil {
+			b.Fatalf("Failed to find process: %v", err)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := p.Update(); err != nil {
+				b.Fatalf("Failed to update process: %v", err)
+			}
+		}
+	})
+	b.Run("all", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := allProcesses(); err != nil {
+				b.Fatalf("Failed to read processes: %v", err)
+			}
+		}
+	})
+}
+
+func TestBreakdown(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start child process: %v", err)
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	p, err := FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("Failed to find process: %v", err)
+	}
+	p.TrackThreads()
+	if err := p.Update(); err != nil {
+		t.Fatalf("Failed to update process: %v", err)
+	}
+
+	var found bool
+	for _, u := range p.Breakdown() {
+		if u.Pid == cmd.Process.Pid {
+			found = true
+			if u.Comm != "sleep" || u.Cmdline != "sleep 10" {
+				t.Errorf("Expecting comm sleep and cmdline 'sleep 10', got %q and %q", u.Comm, u.Cmdline)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expecting child %v in the breakdown", cmd.Process.Pid)
+	}
+
+	var threads int
+	for _, u := range p.ThreadBreakdown() {
+		if u.Name == "" {
+			t.Errorf("Expecting thread names, got %+v", u)
+		}
+		threads += u.Count
+	}
+	// The runtime might start threads between reading the status and the tasks
+	if threads < 2 {
+		t.Errorf("Expecting the threads of the runtime in the breakdown, got %v", threads)
+	}
+}
+
+func TestFindRoot(t *testing.T) {
+	// The duration is unique to this run so nothing else matches it
+	d := fmt.Sprintf("10.%v%v", os.Getpid(), time.Now().UnixNano())
+	script := "sleep " + d + "; true"
+	child := exec.Command("sh", "-c", script)
+	child.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := child.Start(); err != nil {
+		t.Fatalf("Failed to start child process: %v", err)
+	}
+	defer child.Wait()
+	defer syscall.Kill(-child.Process.Pid, syscall.SIGKILL)
+
+	// The shell started in the background is left to init when its parent exits
+	detached := exec.Command("sh", "-c", "sh -c '"+script+"' &")
+	detached.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := detached.Run(); err != nil {
+		t.Fatalf("Failed to start detached process: %v", err)
+	}
+	defer syscall.Kill(-detached.Process.Pid, syscall.SIGKILL)
+
+	// The child descends from the test so only the detached shell and its
+	// sleep match, the shell is the root
+	re := regexp.MustCompile(regexp.QuoteMeta(d))
+	var pid int
+	var err error
+	for i := 0; i < 50; i++ {
+		if pid, err = FindRoot(MatchCmdline(re)); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Failed to find root: %v", err)
+	}
+	if pid == child.Process.Pid {
+		t.Errorf("Expecting child %v of the test not to be matched", pid)
+	}
+	if cmdline := readCmdline(pid); cmdline != "sh -c "+script {
+		t.Errorf("Expecting root to be the detached shell, got %v: %v", pid, cmdline)
+	}
+
+	if _, err := FindRoot(MatchName("no-such-process")); err == nil {
+		t.Errorf("Expecting error finding a process that does not exist")
+	}
+}
+
+func TestMatchName(t *testing.T) {
+	tcs := []struct {
+		name, comm, exe string
+		match           bool
+	}{
+		{"fluent-bit", "fluent-bit", "/usr/bin/fluent-bit", true},
+		{"fluent-bit", "fluentd", "/usr/bin/fluentd", false},
+		{"fluent", "fluent-bit", "/usr/bin/fluent-bit", false},
+		// comm is truncated to 15 bytes
+		{"amazon-cloudwatch-agent", "amazon-cloudwat", "/opt/aws/bin/amazon-cloudwatch-agent", true},
+		{"amazon-cloudwatch-agent", "amazon-cloudwat", "/opt/aws/bin/amazon-cloudwatch-agent (deleted)", true},
+		{"amazon-cloudwatch-agent", "amazon-cloudwat", "/opt/aws/bin/amazon-cloudwatch-other", false},
+		{"amazon-cloudwatch-agent", "amazon-cloudwat", "", true},
+		// Scripts have the interpreter in exe
+		{"amazon-cloudwatch-agent", "amazon-cloudwat", "/usr/bin/python3", true},
+	}
+	for _, tc := range tcs {
+		if got := matchName(tc.name, tc.comm, tc.exe); got != tc.match {
+			t.Errorf("Expecting name %q to match comm %q and exe %q: %v, got %v", tc.name, tc.comm, tc.exe, tc.match, got)
+		}
+	}
+
+	comm, err := ioutil.ReadFile("/proc/self/comm")
+	if err != nil {
+		t.Fatalf("Failed to read comm: %v", err)
+	}
+	if !MatchName(strings.TrimSpace(string(comm)))(os.Getpid()) {
+		t.Errorf("Expecting the test to match its name %q", comm)
+	}
+}
+
+func TestMatchCgroup(t *testing.T) {
+	tcs := []struct {
+		cgroup, mount, path string
+	}{
+		{"/system.slice/app.service", CgroupRoot, "/system.slice/app.service"},
+		{"system.slice/app.service/", CgroupRoot, "/system.slice/app.service"},
+		{"/sys/fs/cgroup/system.slice/app.service", CgroupRoot, "/system.slice/app.service"},
+		{"/sys/fs/cgroup/unified/system.slice/app.service", "/sys/fs/cgroup/unified", "/system.slice/app.service"},
+		{"/sys/fs/cgroup/system.slice", "/sys/fs/cgroup/unified", "/system.slice"},
+		{"/sys/fs/cgroup", CgroupRoot, "/"},
+		{"/sys/fs/cgroupfs/app", CgroupRoot, "/sys/fs/cgroupfs/app"},
+	}
+	for _, tc := range tcs {
+		if got := cgroupPath(tc.cgroup, tc.mount); got != tc.path {
+			t.Errorf("Expecting cgroup %v mounted at %v to be %v, got %v", tc.cgroup, tc.mount, tc.path, got)
+		}
+	}
+
+	cgs := []string{"/system.slice/app.service/worker"}
+	for cgroup, match := range map[string]bool{
+		"/":                                true,
+		"/system.slice":                    true,
+		"/system.slice/app.service":        true,
+		"/system.slice/app.service/worker": true,
+		"/system.slice/app":                false,
+		"/system.slice/app.service/work":   false,
+	} {
+		if got := inCgroup(cgs, cgroup); got != match {
+			t.Errorf("Expecting %v in cgroup %v: %v, got %v", cgs, cgroup, match, got)
+		}
+	}
+
+	own := readCgroups(os.Getpid())
+	if len(own) == 0 {
+		t.Skip("No cgroups to match")
+	}
+	if !MatchCgroup(own[0])(os.Getpid()) {
+		t.Errorf("Expecting the test to match its cgroup %v", own[0])
+	}
+}
+
+func TestMatchUnit(t *testing.T) {
+	for unit, name := range map[string]string{
+		"app":               "app.service",
+		"app.service":       "app.service",
+		"app@1":             "app@1.service",
+		"session-1.scope":   "session-1.scope",
+		"com.example.agent": "com.example.agent.service",
+	} {
+		if got := unitName(unit); got != name {
+			t.Errorf("Expecting unit %v to be named %v, got %v", unit, name, got)
+		}
+	}
+
+	cgs := []string{"/system.slice/app.service/worker", "/user.slice/user-1000.slice/session-1.scope"}
+	for unit, match := range map[string]bool{
+		"app.service":       true,
+		"system.slice":      true,
+		"session-1.scope":   true,
+		"user-1000.slice":   true,
+		"worker.service":    false,
+		"other.service":     false,
+		"app.service/other": false,
+	} {
+		if got := inUnit(cgs, unit); got != match {
+			t.Errorf("Expecting %v in unit %v: %v, got %v", cgs, unit, match, got)
+		}
+	}
+}
+
+func TestCgroupStats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"cpu.stat":       "usage_usec 3000000\nuser_usec 2000000\nsystem_usec 1000000\nnr_periods 50\nnr_throttled 5\nthrottled_usec 250000\n",
+		"memory.current": "1048576\n",
+		"memory.events":  "low 0\nhigh 2\nmax 3\noom 1\noom_kill 1\n",
+		"io.stat":        "8:0 rbytes=4096 wbytes=8192 rios=1 wios=2 dbytes=0 dios=0\n8:16 rbytes=4096 wbytes=0 rios=1 wios=0\n",
+	}
+	for f, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, f), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %v: %v", f, err)
+		}
+	}
+
+	c := &Cgroup{dir: dir}
+	s, err := c.Stats()
+	if err != nil {
+		t.Fatalf("Failed to read cgroup stats: %v", err)
+	}
+	expected := CgroupStats{
+		CPUUsage:         3 * time.Second,
+		CPUUser:          2 * time.Second,
+		CPUSystem:        time.Second,
+		Throttled:        250 * time.Millisecond,
+		Periods:          50,
+		ThrottledPeriods: 5,
+		Memory:           1048576,
+		MemoryEvents:     MemoryEvents{High: 2, Max: 3, OOM: 1, OOMKill: 1},
+		IO:               CgroupIO{RBytes: 8192, WBytes: 8192, RIOs: 2, WIOs: 2},
+	}
+	if s != expected {
+		t.Errorf("Expecting stats %+v, got %+v", expected, s)
+	}
+
+	// Without the memory and io controllers only the cpu usage is read
+	os.Remove(filepath.Join(dir, "memory.current"))
+	os.Remove(filepath.Join(dir, "memory.events"))
+	os.Remove(filepath.Join(dir, "io.stat"))
+	s, err = c.Stats()
+	if err != nil {
+		t.Fatalf("Failed to read cgroup stats without memory and io: %v", err)
+	}
+	if s.CPUUsage != 3*time.Second || s.Memory != 0 || s.IO != (CgroupIO{}) {
+		t.Errorf("Expecting only cpu usage, got %+v", s)
+	}
+}
+
+func TestCgroupRemove(t *testing.T) {
+	// A directory stands in for the mount of the cgroup hierarchy
+	mount, err := ioutil.TempDir("", "cgroup")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(mount)
+
+	c, err := newCgroup(mount, "created")
+	if err != nil {
+		t.Fatalf("Failed to create cgroup: %v", err)
+	}
+	if !c.Created() {
+		t.Errorf("Expecting cgroup %v to be created", c.Path())
+	}
+	if err := c.Remove(); err != nil {
+		t.Errorf("Failed to remove cgroup: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(mount, "created")); !os.IsNotExist(err) {
+		t.Errorf("Expecting the created cgroup to be removed, got %v", err)
+	}
+
+	existing := filepath.Join(mount, "existing")
+	if err := os.Mkdir(existing, 0755); err != nil {
+		t.Fatalf("Failed to create cgroup: %v", err)
+	}
+	limits := map[string]string{"cpu.max": "max 100000", "memory.max": "max"}
+	for f, v := range limits {
+		if err := ioutil.WriteFile(filepath.Join(existing, f), []byte(v+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %v: %v", f, err)
+		}
+	}
+	read := func(f string) string {
+		b, err := ioutil.ReadFile(filepath.Join(existing, f))
+		if err != nil {
+			t.Fatalf("Failed to read %v: %v", f, err)
+		}
+		return string(b)
+	}
+	c, err = newCgroup(mount, "existing", OptCPUMax(0.5), OptMemoryMax(1<<20))
+	if err != nil {
+		t.Fatalf("Failed to use existing cgroup: %v", err)
+	}
+	if c.Created() {
+		t.Errorf("Expecting cgroup %v to exist already", c.Path())
+	}
+	if got := strings.TrimSpace(read("memory.max")); got != "1048576" {
+		t.Errorf("Expecting the memory limit to be set, got %v", got)
+	}
+	if err := c.Remove(); err != nil {
+		t.Errorf("Failed to remove cgroup: %v", err)
+	}
+	if _, err := os.Stat(existing); err != nil {
+		t.Errorf("Expecting the existing cgroup to be kept, got %v", err)
+	}
+	for f, v := range limits {
+		if got := read(f); got != v {
+			t.Errorf("Expecting %v of the existing cgroup to be restored to %q, got %q", f, v, got)
+		}
+	}
+}
+
+func TestUnavailable(t *testing.T) {
+	p, err := FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("Failed to find process: %v", err)
+	}
+	if errs := p.Unavailable(); len(errs) > 0 {
+		t.Errorf("Expecting every detail of the own process to be readable, got %v", errs)
+	}
+
+	// Errors of exited processes are left to the next update
+	p.detailErr(DetailIO, &os.PathError{Op: "open", Path: "/proc/1/io", Err: syscall.ENOENT})
+	p.detailErr(DetailFDs, &os.PathError{Op: "open", Path: "/proc/1/fd", Err: syscall.EACCES})
+	errs := p.Unavailable()
+	if _, ok := errs[DetailFDs]; !ok || len(errs) != 1 {
+		t.Errorf("Expecting only the descriptors to be unavailable, got %v", errs)
+	}
+}
+
+func TestCtxtSwitches(t *testing.T) {
+	p, err := FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("Failed to find process: %v", err)
+	}
+
+	// Threads other than the thread group leader sleep, the goroutines are
+	// locked to them so each sleep blocks the thread, which is a voluntary
+	// context switch
+	const threads, sleeps = 4, 20
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			for j := 0; j < sleeps; j++ {
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := p.Update(); err != nil {
+		t.Fatalf("Failed to update process: %v", err)
+	}
+	if v, _ := p.CtxtSwitchesDelta(); v < threads*sleeps {
+		t.Errorf("Expecting at least %v voluntary context switches of the sleeping threads, got %v", threads*sleeps, v)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rotator
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+)
+
+type namer interface {
+	Name() string
+}
+
+// Appender writes to the live file of a Writer through its own file
+// descriptor opened with O_APPEND, like another process logging to the same
+// file. Its writes count towards the rotation limits of the Writer, and it
+// reopens the live file after the Writer rotated it.
+type Appender struct {
+	mu sync.Mutex
+	w  *Writer
+
+	f          file
+	generation int
+}
+
+// NewAppender returns an Appender for the live file of w.
+func (w *Writer) NewAppender() *Appender {
+	return &Appender{w: w}
+}
+
+func (a *Appender) Write(b []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.open(int64(len(b)), int64(bytes.Count(b, []byte{'\n'})), int64(len(b))); err != nil {
+		return 0, err
+	}
+	return a.f.Write(b)
+}
+
+// Hole extends the file by n bytes without writing them, see Writer.Hole.
+func (a *Appender) Hole(n int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.open(n, 0, 0); err != nil {
+		return err
+	}
+	return makeHole(a.f, n)
+}
+
+// open rotates the file of the Writer if needed, accounts for a write of size
+// bytes, lines and written bytes and opens the live file if it changed.
+func (a *Appender) open(size, lines, written int64) error {
+	a.w.mu.Lock()
+	if a.w.closed {
+		a.w.mu.Unlock()
+		return os.ErrClosed
+	}
+	if err := a.w.maybeRotate(size); err != nil {
+		a.w.mu.Unlock()
+		return err
+	}
+	// Account for the write up front, so it happens outside of the lock of the Writer
+	a.w.size += size
+	a.w.lines += lines
+	a.w.written += written
+	generation := a.w.generation
+	n, ok := a.w.w.(namer)
+	mode := a.w.c.IOMode
+	prealloc := a.w.c.Preallocate
+	a.w.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("writer of rotator %T has no file name to append to", a.w.r)
+	}
+	if mode == IOModeDirect || mode == IOModeMmap {
+		return fmt.Errorf("appending is not supported with io mode %v", mode)
+	}
+	if prealloc > 0 {
+		return fmt.Errorf("appending is not supported to preallocated files")
+	}
+	if a.f == nil || generation != a.generation {
+		if err := closeFile(a.f); err != nil {
+			return fmt.Errorf("failed to close file %v: %w", n.Name(), err)
+		}
+		a.f = nil
+		f, err := openFile(n.Name(), mode, 0)
+		if err != nil {
+			return fmt.Errorf("failed to open file %v: %w", n.Name(), err)
+		}
+		a.f = f
+		a.generation = generation
+	}
+	return nil
+}
+
+// Close closes the file descriptor of the Appender, the Writer is not closed.
+func (a *Appender) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f := a.f
+	a.f = nil
+	return closeFile(f)
+}
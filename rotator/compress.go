@@ -0,0 +1,97 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rotator
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+const compressExt = ".gz"
+
+// OptCompress gzips backups in the background after rotation, with delay the
+// newest backup is left uncompressed until the next rotation like logrotate's
+// delaycompress.
+func OptCompress(delay bool) func(o *options) {
+	return func(o *options) {
+		o.compress = true
+		o.delayCompress = delay
+	}
+}
+
+// compressBackup compresses the newest backup, or the previous one with
+// delaycompress, in the background.
+func (o *options) compressBackup(newest, previous string) {
+	if !o.compress {
+		return
+	}
+	p := newest
+	if o.delayCompress {
+		p = previous
+	}
+	if p == "" {
+		return
+	}
+	if _, err := os.Stat(p); err != nil {
+		return
+	}
+
+	o.compressing.Add(1)
+	go func() {
+		defer o.compressing.Done()
+		if err := gzipFile(p); err != nil {
+			log.Printf("Failed to compress %v: %v", p, err)
+		}
+	}()
+}
+
+// waitCompress waits for the backups being compressed, it should be called
+// before the backups are moved or removed.
+func (o *options) waitCompress() {
+	o.compressing.Wait()
+}
+
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	gzPath := path + compressExt
+	out, err := os.Create(gzPath)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to write %v: %w", gzPath, err)
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to write %v: %w", gzPath, err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rotator
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// CopyTruncateRotator rotates like logrotate's copytruncate: the live file is
+// copied to the first backup and then truncated in place, so the writer keeps
+// its file descriptor. Lines written between the copy and the truncate are
+// lost, the delay can be used to widen that window.
+type CopyTruncateRotator struct {
+	path  string
+	keep  int
+	delay time.Duration
+
+	current    file
+	truncating sync.WaitGroup
+	*options
+}
+
+func NewCopyTruncateRotator(path string, keep int, delay time.Duration, opts ...Opt) *CopyTruncateRotator {
+	return &CopyTruncateRotator{path: path, keep: keep, delay: delay, options: newOptions(opts)}
+}
+
+func (cr *CopyTruncateRotator) Rotate() (io.Writer, error) {
+	log.Printf("Rotating %v", cr.path)
+	if cr.current == nil {
+		// O_APPEND keeps writes at the end of the file after it is truncated
+		f, err := cr.createFile(cr.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file %v: %w", cr.path, err)
+		}
+		cr.current = cr.wrap(f)
+		return cr.current, nil
+	}
+
+	// A truncate from the previous rotation might still be pending
+	cr.truncating.Wait()
+
+	cr.waitCompress()
+	if err := cr.rotateFiles(cr.path, cr.keep, 1); err != nil {
+		return nil, fmt.Errorf("failed to rotate old log files: %w", err)
+	}
+
+	if cr.keep > 0 {
+		if err := CopyFile(cr.path, cr.numberedBackup(cr.path, 1)); err != nil {
+			return nil, fmt.Errorf("failed to copy current file %v: %w", cr.path, err)
+		}
+		cr.compressBackup(cr.numberedBackup(cr.path, 1), cr.numberedBackup(cr.path, 2))
+	}
+
+	if cr.delay <= 0 {
+		if err := cr.truncate(cr.current); err != nil {
+			return nil, fmt.Errorf("failed to truncate current file %v: %w", cr.path, err)
+		}
+		return cr.current, nil
+	}
+
+	cr.truncating.Add(1)
+	go func(f file) {
+		defer cr.truncating.Done()
+		time.Sleep(cr.delay)
+		if err := cr.truncate(f); err != nil {
+			log.Printf("Failed to truncate current file %v: %v", cr.path, err)
+		}
+	}(cr.current)
+	return cr.current, nil
+}
+
+// truncate truncates f in place and writes the header again, with a delay
+// writes are held back meanwhile, so the header stays at the start.
+func (cr *CopyTruncateRotator) truncate(f file) error {
+	if df, ok := f.(*delayedFile); ok {
+		df.mu.Lock()
+		defer df.mu.Unlock()
+		f = df.file
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	return cr.writeHeader(f)
+}
+
+// wrap serializes writes to f with the truncate running in the background
+// when there is a delay.
+func (cr *CopyTruncateRotator) wrap(f file) file {
+	if cr.delay <= 0 {
+		return f
+	}
+	return &delayedFile{file: f}
+}
+
+func (cr *CopyTruncateRotator) Reopen() (io.Writer, error) {
+	cr.truncating.Wait()
+	f, err := cr.reopenFile(cr.current, cr.path)
+	if err != nil {
+		return nil, err
+	}
+	cr.current = cr.wrap(f)
+	return cr.current, nil
+}
+
+func (cr *CopyTruncateRotator) Close() error {
+	cr.truncating.Wait()
+	cr.waitCompress()
+	return closeFile(cr.current)
+}
+
+func (cr *CopyTruncateRotator) Remove() error {
+	return cr.removeNumbered(cr.path, cr.keep)
+}
+
+// CopyFile copies the content of src to a new file dst.
+func CopyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// delayedFile is the live file of a copytruncate rotator with a delay, its
+// writes wait for a truncate in progress.
+type delayedFile struct {
+	file
+	mu sync.Mutex
+}
+
+func (f *delayedFile) Write(b []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Write(b)
+}
+
+func (f *delayedFile) hole(n int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return makeHole(f.file, n)
+}
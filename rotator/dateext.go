@@ -0,0 +1,119 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rotator
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+const DefaultDateExtFormat = "-20060102"
+
+// DateExtRotator rotates like logrotate's dateext option: the live file is
+// renamed to a backup with the date appended, e.g. app.log-20240101, and a new
+// live file is created. A counter is added when the name is already taken.
+type DateExtRotator struct {
+	path   string
+	keep   int
+	format string
+
+	backup  string
+	n       int
+	current file
+	backups backupList
+	*options
+}
+
+func NewDateExtRotator(path string, keep int, format string, opts ...Opt) *DateExtRotator {
+	if format == "" {
+		format = DefaultDateExtFormat
+	}
+	return &DateExtRotator{path: path, keep: keep, format: format, options: newOptions(opts)}
+}
+
+func (dr *DateExtRotator) Rotate() (io.Writer, error) {
+	log.Printf("Rotating %v", dr.path)
+	if dr.current != nil {
+		if err := dr.current.Close(); err != nil {
+			return nil, fmt.Errorf("failed to close current file %v: %w", dr.path, err)
+		}
+
+		if err := dr.rotateFiles(); err != nil {
+			return nil, fmt.Errorf("failed to rotate old log files: %w", err)
+		}
+	}
+
+	f, err := dr.createFile(dr.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file %v: %w", dr.path, err)
+	}
+	dr.current = f
+	return f, nil
+}
+
+func (dr *DateExtRotator) Reopen() (io.Writer, error) {
+	f, err := dr.reopenFile(dr.current, dr.path)
+	if err != nil {
+		return nil, err
+	}
+	dr.current = f
+	return f, nil
+}
+
+func (dr *DateExtRotator) Close() error {
+	dr.waitCompress()
+	return closeFile(dr.current)
+}
+
+func (dr *DateExtRotator) Remove() error {
+	return removeFiles(append([]string{dr.path}, dr.backups...)...)
+}
+
+func (dr *DateExtRotator) rotateFiles() error {
+	if err := dr.ensureArchiveDir(); err != nil {
+		return err
+	}
+
+	// Count up within the same date, so names of removed files are not reused
+	if b := dr.archived(dr.path) + time.Now().Format(dr.format); b != dr.backup {
+		dr.backup = b
+		dr.n = 0
+	}
+	t, err := firstFreePath(func(int) string {
+		dr.n++
+		if dr.n == 1 {
+			return dr.backup
+		}
+		return fmt.Sprintf("%v.%v", dr.backup, dr.n-1)
+	})
+	if err != nil {
+		return err
+	}
+	if err := moveFile(dr.path, t); err != nil {
+		return fmt.Errorf("failed to move %v to %v: %w", dr.path, t, err)
+	}
+	dr.waitCompress()
+	dr.backups = append(dr.backups, t)
+	if err := dr.backups.prune(dr.keep, dr.options); err != nil {
+		return err
+	}
+	dr.compressBackup(dr.backups.newest(0), dr.backups.newest(1))
+	return nil
+}
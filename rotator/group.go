@@ -0,0 +1,119 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rotator
+
+import (
+	"sync"
+	"time"
+)
+
+// Group rotates a set of writers together, either all at once in lock-step
+// or staggered evenly over a period.
+type Group struct {
+	mu      sync.Mutex
+	writers []*Writer
+	stagger time.Duration
+	// sleep waits before the staggered rotation of a writer
+	sleep func(d time.Duration)
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewGroup creates a group of writers, a zero stagger rotates them in lock-step.
+func NewGroup(ws []*Writer, stagger time.Duration) *Group {
+	return &Group{writers: ws, stagger: stagger, sleep: time.Sleep, done: make(chan struct{})}
+}
+
+// Add adds a writer to the group, e.g. a logfile created while the group is
+// rotated periodically.
+func (g *Group) Add(w *Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.writers = append(g.writers, w)
+}
+
+// Remove removes a writer from the group before it is closed.
+func (g *Group) Remove(w *Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i, gw := range g.writers {
+		if gw == w {
+			g.writers = append(g.writers[:i:i], g.writers[i+1:]...)
+			return
+		}
+	}
+}
+
+// RotateAll rotates every writer of the group and returns the first error.
+func (g *Group) RotateAll() error {
+	g.mu.Lock()
+	ws := g.writers
+	g.mu.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(ws))
+	for i, w := range ws {
+		wg.Add(1)
+		go func(i int, w *Writer) {
+			defer wg.Done()
+			if g.stagger > 0 {
+				g.sleep(g.stagger * time.Duration(i) / time.Duration(len(ws)))
+			}
+			errs[i] = w.Rotate()
+		}(i, w)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RotateEvery rotates the group at every multiple of d on the wall clock, so
+// with 24h all files rotate at midnight UTC, until Stop is called. Errors are
+// passed to onErr.
+func (g *Group) RotateEvery(d time.Duration, onErr func(err error)) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		for {
+			now := time.Now()
+			t := time.NewTimer(now.Truncate(d).Add(d).Sub(now))
+			select {
+			case <-t.C:
+				if err := g.RotateAll(); err != nil && onErr != nil {
+					onErr(err)
+				}
+			case <-g.done:
+				t.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (g *Group) Stop() {
+	close(g.done)
+	g.wg.Wait()
+}
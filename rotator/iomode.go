@@ -0,0 +1,95 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rotator
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// IO modes select how the live file is opened and written.
+const (
+	// IOModeBuffered writes through the page cache, like most loggers
+	IOModeBuffered = "buffered"
+	// IOModeSync and IOModeDSync open the file with O_SYNC and O_DSYNC, so
+	// every write waits for the data to reach stable storage
+	IOModeSync  = "sync"
+	IOModeDSync = "dsync"
+	// IOModeDirect opens the file with O_DIRECT and writes aligned blocks,
+	// bypassing the page cache
+	IOModeDirect = "direct"
+	// IOModeMmap writes through a shared memory mapping of the file
+	IOModeMmap = "mmap"
+)
+
+var ioModes = []string{IOModeBuffered, IOModeSync, IOModeDSync, IOModeDirect, IOModeMmap}
+
+// file is the live file written by a rotator, an *os.File unless the io mode
+// needs to do more than plain writes.
+type file interface {
+	io.Writer
+	Name() string
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// OptIOMode selects how files are opened and written, one of the IOMode
+// constants.
+func OptIOMode(mode string) func(o *options) {
+	return func(o *options) {
+		o.ioMode = mode
+	}
+}
+
+func checkIOMode(mode string) error {
+	for _, m := range ioModes {
+		if mode == m {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported io mode '%v', expecting one of %v", mode, ioModes)
+}
+
+// openFile opens path for appending with the given io mode, creating it if
+// needed. flag is added to the open flags, e.g. os.O_TRUNC.
+func openFile(path, mode string, flag int) (file, error) {
+	switch mode {
+	case "", IOModeBuffered:
+		return openAppend(path, flag)
+	case IOModeSync:
+		return openAppend(path, flag|os.O_SYNC)
+	case IOModeDSync:
+		return openAppend(path, flag|oDSync)
+	case IOModeDirect:
+		return openDirect(path, flag)
+	case IOModeMmap:
+		return openMmap(path, flag, 0)
+	default:
+		return nil, checkIOMode(mode)
+	}
+}
+
+func openAppend(path string, flag int) (file, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND|flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,347 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rotator
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const oDSync = syscall.O_DSYNC
+
+// fallocate allocates the first size bytes of f, extending the file if
+// needed, file systems without fallocate get a sparse file instead.
+func fallocate(f *os.File, size int64) error {
+	err := syscall.Fallocate(int(f.Fd()), 0, 0, size)
+	if err == syscall.EOPNOTSUPP {
+		return f.Truncate(size)
+	}
+	return err
+}
+
+// directBlock is the alignment of buffers, offsets and sizes for O_DIRECT
+const directBlock = 4096
+
+// directFile writes whole blocks with O_DIRECT from an aligned buffer. The
+// last partial block is kept in the buffer and only written on Sync and
+// Close, through a second descriptor without O_DIRECT, so readers see the
+// data in block sized bursts.
+type directFile struct {
+	mu   sync.Mutex
+	f    *os.File
+	tail *os.File
+	buf  []byte
+	// n bytes of buf are pending to be written at off
+	n   int
+	off int64
+}
+
+func openDirect(path string, flag int) (file, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|syscall.O_DIRECT|flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+	tail, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	d := &directFile{f: f, tail: tail, buf: alignedBlock()}
+	fi, err := f.Stat()
+	if err == nil {
+		err = d.load(fi.Size())
+	}
+	if err != nil {
+		f.Close()
+		tail.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+func alignedBlock() []byte {
+	b := make([]byte, 2*directBlock)
+	i := int(uintptr(unsafe.Pointer(&b[0])) & (directBlock - 1))
+	if i > 0 {
+		i = directBlock - i
+	}
+	return b[i : i+directBlock : i+directBlock]
+}
+
+// load continues writing at the end of the file of size bytes, with its
+// last partial block read into the buffer.
+func (d *directFile) load(size int64) error {
+	d.off = size - size%directBlock
+	d.n = int(size - d.off)
+	if d.n == 0 {
+		return nil
+	}
+	if _, err := d.tail.ReadAt(d.buf[:d.n], d.off); err != nil {
+		return fmt.Errorf("failed to read last block of %v: %w", d.f.Name(), err)
+	}
+	return nil
+}
+
+func (d *directFile) Write(b []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var written int
+	for len(b) > 0 {
+		c := copy(d.buf[d.n:], b)
+		d.n += c
+		b = b[c:]
+		if d.n == len(d.buf) {
+			if _, err := d.f.WriteAt(d.buf, d.off); err != nil {
+				d.n -= c
+				return written, err
+			}
+			d.off += directBlock
+			d.n = 0
+		}
+		written += c
+	}
+	return written, nil
+}
+
+func (d *directFile) hole(n int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.writeTail(); err != nil {
+		return err
+	}
+	size := d.off + int64(d.n) + n
+	if err := d.f.Truncate(size); err != nil {
+		return err
+	}
+	return d.load(size)
+}
+
+func (d *directFile) writeTail() error {
+	if d.n == 0 {
+		return nil
+	}
+	_, err := d.tail.WriteAt(d.buf[:d.n], d.off)
+	return err
+}
+
+func (d *directFile) Name() string {
+	return d.f.Name()
+}
+
+func (d *directFile) Sync() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.writeTail(); err != nil {
+		return err
+	}
+	return d.f.Sync()
+}
+
+// Truncate keeps the partial block in the buffer when the file is truncated
+// to zero, it ends up in the new file like with buffered loggers.
+func (d *directFile) Truncate(size int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.f.Truncate(size); err != nil {
+		return err
+	}
+	if size == 0 {
+		d.off = 0
+		return nil
+	}
+	return d.load(size)
+}
+
+func (d *directFile) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	err := d.writeTail()
+	if cerr := d.tail.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := d.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// mmapChunk is the size by which the mapping of an mmapFile grows
+const mmapChunk = 1 << 20
+
+// mmapFile writes through a shared memory mapping of the file. The file is
+// grown with ftruncate before every write and the mapping in chunks, the
+// stores to the mapping are not write calls and generate no inotify events.
+// A preallocated file is only grown once the data exceeds it, and truncated
+// to the data on close.
+type mmapFile struct {
+	mu   sync.Mutex
+	f    *os.File
+	data []byte
+	// size is the length of the data, alloc the length of the file
+	size     int64
+	alloc    int64
+	prealloc int64
+}
+
+func openMmap(path string, flag int, prealloc int64) (file, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	m := &mmapFile{f: f, size: fi.Size(), alloc: fi.Size(), prealloc: prealloc}
+	if err := m.preallocate(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *mmapFile) preallocate() error {
+	if m.prealloc <= m.alloc {
+		return nil
+	}
+	if err := fallocate(m.f, m.prealloc); err != nil {
+		return fmt.Errorf("failed to preallocate %v: %w", m.f.Name(), err)
+	}
+	m.alloc = m.prealloc
+	return nil
+}
+
+func (m *mmapFile) Write(b []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	end := m.size + int64(len(b))
+	if end > int64(len(m.data)) {
+		if err := m.remap(end); err != nil {
+			return 0, err
+		}
+	}
+	if end > m.alloc {
+		if err := m.f.Truncate(end); err != nil {
+			return 0, err
+		}
+		m.alloc = end
+	}
+	copy(m.data[m.size:], b)
+	m.size = end
+	return len(b), nil
+}
+
+func (m *mmapFile) hole(n int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.size += n
+	if m.size > m.alloc {
+		if err := m.f.Truncate(m.size); err != nil {
+			return err
+		}
+		m.alloc = m.size
+	}
+	return nil
+}
+
+func (m *mmapFile) remap(size int64) error {
+	if err := m.unmap(); err != nil {
+		return err
+	}
+	size = (size + mmapChunk - 1) / mmapChunk * mmapChunk
+	data, err := syscall.Mmap(int(m.f.Fd()), 0, int(size), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return fmt.Errorf("failed to map %v: %w", m.f.Name(), err)
+	}
+	m.data = data
+	return nil
+}
+
+func (m *mmapFile) unmap() error {
+	if m.data == nil {
+		return nil
+	}
+	if err := syscall.Munmap(m.data); err != nil {
+		return fmt.Errorf("failed to unmap %v: %w", m.f.Name(), err)
+	}
+	m.data = nil
+	return nil
+}
+
+func (m *mmapFile) Name() string {
+	return m.f.Name()
+}
+
+func (m *mmapFile) Sync() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.size > 0 && len(m.data) > 0 {
+		n := m.size
+		if n > int64(len(m.data)) {
+			n = int64(len(m.data))
+		}
+		_, _, errno := syscall.Syscall(syscall.SYS_MSYNC, uintptr(unsafe.Pointer(&m.data[0])), uintptr(n), syscall.MS_SYNC)
+		if errno != 0 {
+			return fmt.Errorf("failed to sync mapping of %v: %w", m.f.Name(), errno)
+		}
+	}
+	return m.f.Sync()
+}
+
+func (m *mmapFile) Truncate(size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.f.Truncate(size); err != nil {
+		return err
+	}
+	m.size = size
+	m.alloc = size
+	return m.preallocate()
+}
+
+func (m *mmapFile) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err := m.unmap()
+	if m.alloc > m.size {
+		if terr := m.f.Truncate(m.size); err == nil {
+			err = terr
+		}
+	}
+	if cerr := m.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,42 @@
+//go:build !linux
+// +build !linux
+
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rotator
+
+import (
+	"fmt"
+	"os"
+)
+
+// fallocate falls back to extending the file without allocating its blocks
+func fallocate(f *os.File, size int64) error {
+	return f.Truncate(size)
+}
+
+// O_DSYNC is not available everywhere, O_SYNC is the stricter fallback
+const oDSync = os.O_SYNC
+
+func openDirect(path string, flag int) (file, error) {
+	return nil, fmt.Errorf("io mode %v is only supported on linux", IOModeDirect)
+}
+
+func openMmap(path string, flag int, prealloc int64) (file, error) {
+	return nil, fmt.Errorf("io mode %v is only supported on linux", IOModeMmap)
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rotator
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// OptArchiveDir moves rotated files into dir instead of keeping them next to the live file.
+func OptArchiveDir(dir string) func(o *options) {
+	return func(o *options) {
+		o.archiveDir = dir
+	}
+}
+
+// OptMaxAge removes rotated files last modified longer than d ago.
+func OptMaxAge(d time.Duration) func(o *options) {
+	return func(o *options) {
+		o.maxAge = d
+	}
+}
+
+// OptMaxBytes removes the oldest rotated files once all of them together exceed n bytes.
+func OptMaxBytes(n int64) func(o *options) {
+	return func(o *options) {
+		o.maxBytes = n
+	}
+}
+
+// archived returns where the rotated file p is kept.
+func (o *options) archived(p string) string {
+	if o.archiveDir == "" {
+		return p
+	}
+	return filepath.Join(o.archiveDir, filepath.Base(p))
+}
+
+// numberedBackup returns the path of the nth backup of path, where the 0th
+// backup is path itself.
+func (o *options) numberedBackup(path string, n int) string {
+	if n == 0 {
+		return path
+	}
+	return o.archived(nthBackupPath(path, n))
+}
+
+func (o *options) ensureArchiveDir() error {
+	if o.archiveDir == "" {
+		return nil
+	}
+	return os.MkdirAll(o.archiveDir, 0755)
+}
+
+// archive moves the rotated file p into the archive dir if there is one.
+func (o *options) archive(p string) error {
+	if o.archiveDir == "" {
+		return nil
+	}
+	if err := o.ensureArchiveDir(); err != nil {
+		return err
+	}
+	return moveFile(p, o.archived(p))
+}
+
+// retain removes backups beyond the max age or the max total size, whether
+// or not they are still opened by an agent. The backups are given newest
+// first, the number of backups kept is returned.
+func (o *options) retain(backups []string) (int, error) {
+	if o.maxAge <= 0 && o.maxBytes <= 0 {
+		return len(backups), nil
+	}
+
+	var total int64
+	for i, b := range backups {
+		fi, err := os.Stat(b)
+		if os.IsNotExist(err) {
+			fi, err = os.Stat(b + compressExt)
+		}
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return i, err
+		}
+
+		total += fi.Size()
+		if (o.maxAge > 0 && time.Since(fi.ModTime()) > o.maxAge) || (o.maxBytes > 0 && total > o.maxBytes) {
+			for _, r := range backups[i:] {
+				if err := removeBackup(r); err != nil {
+					return i, err
+				}
+			}
+			return i, nil
+		}
+	}
+	return len(backups), nil
+}
+
+// removeBackup removes the backup p, compressed or not.
+func removeBackup(p string) error {
+	for _, ext := range []string{"", compressExt} {
+		err := os.Remove(p + ext)
+		if err == nil {
+			log.Printf("Removed %v", p+ext)
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %v: %w", p+ext, err)
+		}
+	}
+	return nil
+}
+
+// removeNumbered removes path and its numbered backups up to the keep-th
+func (o *options) removeNumbered(path string, keep int) error {
+	for i := 0; i <= keep; i++ {
+		if err := removeBackup(o.numberedBackup(path, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeFiles removes the files at paths, compressed or not
+func removeFiles(paths ...string) error {
+	for _, p := range paths {
+		if err := removeBackup(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveFile renames src to dst, or copies it when they are on different file systems.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := CopyFile(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
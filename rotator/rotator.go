@@ -28,17 +28,83 @@ import (
 
 type Rotator interface {
 	Rotate() (io.Writer, error)
+	Close() error
+}
+
+// Reopener is implemented by rotators that can reopen the live file in place,
+// e.g. after it was replaced by another file.
+type Reopener interface {
+	Reopen() (io.Writer, error)
+}
+
+// Remover is implemented by rotators that can remove the files they wrote, the
+// live file and its backups, once they are closed.
+type Remover interface {
+	Remove() error
+}
+
+const (
+	SchemeCreate       = "create"
+	SchemeCopyTruncate = "copytruncate"
+	SchemeDateExt      = "dateext"
+	SchemeTimestamp    = "timestamp"
+	SchemeSymlink      = "symlink"
+)
+
+// NewRotator creates the Rotator for path using the rotation scheme in c.
+func NewRotator(path string, c Config) (Rotator, error) {
+	var opts []Opt
+	if c.Compress {
+		opts = append(opts, OptCompress(c.DelayCompress))
+	}
+	if c.ArchiveDir != "" {
+		opts = append(opts, OptArchiveDir(c.ArchiveDir))
+	}
+	if c.MaxAge > 0 {
+		opts = append(opts, OptMaxAge(c.MaxAge))
+	}
+	if c.MaxBytes > 0 {
+		opts = append(opts, OptMaxBytes(c.MaxBytes))
+	}
+	if c.Preallocate > 0 {
+		opts = append(opts, OptPreallocate(c.Preallocate))
+	}
+	if len(c.Header) > 0 {
+		opts = append(opts, OptHeader(c.Header))
+	}
+	if c.IOMode != "" {
+		if err := checkIOMode(c.IOMode); err != nil {
+			return nil, err
+		}
+		opts = append(opts, OptIOMode(c.IOMode))
+	}
+
+	switch c.Scheme {
+	case "", SchemeCreate:
+		return NewFileRotator(path, c.Keep, opts...), nil
+	case SchemeCopyTruncate:
+		return NewCopyTruncateRotator(path, c.Keep, c.TruncateDelay, opts...), nil
+	case SchemeDateExt:
+		return NewDateExtRotator(path, c.Keep, c.DateFormat, opts...), nil
+	case SchemeTimestamp:
+		return NewTimestampRotator(path, c.Keep, c.DateFormat, opts...), nil
+	case SchemeSymlink:
+		return NewSymlinkRotator(path, c.Keep, opts...), nil
+	default:
+		return nil, fmt.Errorf("unsupported rotation scheme '%v'", c.Scheme)
+	}
 }
 
 type FileRotator struct {
 	path string
 	keep int
 
-	current *os.File
+	current file
+	*options
 }
 
-func NewFileRotator(path string, keep int) *FileRotator {
-	return &FileRotator{path: path, keep: keep}
+func NewFileRotator(path string, keep int, opts ...Opt) *FileRotator {
+	return &FileRotator{path: path, keep: keep, options: newOptions(opts)}
 }
 
 func (fr *FileRotator) Rotate() (io.Writer, error) {
@@ -48,12 +114,14 @@ func (fr *FileRotator) Rotate() (io.Writer, error) {
 			return nil, fmt.Errorf("failed to close current file %v: %w", fr.path, err)
 		}
 
-		if err := fr.rotateFiles(); err != nil {
+		fr.waitCompress()
+		if err := fr.rotateFiles(fr.path, fr.keep, 0); err != nil {
 			return nil, fmt.Errorf("failed to rotate old log files: %w", err)
 		}
+		fr.compressBackup(fr.numberedBackup(fr.path, 1), fr.numberedBackup(fr.path, 2))
 	}
 
-	f, err := os.Create(fr.path)
+	f, err := fr.createFile(fr.path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create file %v: %w", fr.path, err)
 	}
@@ -61,30 +129,199 @@ func (fr *FileRotator) Rotate() (io.Writer, error) {
 	return f, nil
 }
 
-func (fr FileRotator) rotateFiles() error {
-	for i := fr.keep - 1; i >= 0; i-- {
-		f := fr.nthBackupPath(i)
-		_, err := os.Stat(f)
-		if os.IsNotExist(err) {
-			continue
-		}
-		if err != nil {
+func (fr *FileRotator) Reopen() (io.Writer, error) {
+	f, err := fr.reopenFile(fr.current, fr.path)
+	if err != nil {
+		return nil, err
+	}
+	fr.current = f
+	return f, nil
+}
+
+func (fr *FileRotator) Close() error {
+	fr.waitCompress()
+	return closeFile(fr.current)
+}
+
+func (fr *FileRotator) Remove() error {
+	return fr.removeNumbered(fr.path, fr.keep)
+}
+
+// rotateFiles shifts the numbered backups of path up by one, starting from
+// the first-th backup, where the 0th backup is path itself, and applies the
+// retention policy. Compressed backups are shifted along with the
+// uncompressed ones.
+func (o *options) rotateFiles(path string, keep, first int) error {
+	if err := o.ensureArchiveDir(); err != nil {
+		return err
+	}
+	// Without backups to keep the keep-th backup is the live file itself, or
+	// a backup the rotator never creates.
+	if keep > 0 && keep >= first {
+		if err := removeBackup(o.numberedBackup(path, keep)); err != nil {
 			return err
 		}
-		t := fr.nthBackupPath(i + 1)
-		if err := os.Rename(f, t); err != nil {
-			return fmt.Errorf("failed to move %v to %v: %w", f, t, err)
+	}
+
+	for i := keep - 1; i >= first; i-- {
+		for _, ext := range []string{"", compressExt} {
+			f := o.numberedBackup(path, i) + ext
+			_, err := os.Stat(f)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			t := o.numberedBackup(path, i+1) + ext
+			if err := moveFile(f, t); err != nil {
+				return fmt.Errorf("failed to move %v to %v: %w", f, t, err)
+			}
 		}
 	}
-	return nil
+
+	var backups []string
+	for i := 1; i <= keep; i++ {
+		backups = append(backups, o.numberedBackup(path, i))
+	}
+	_, err := o.retain(backups)
+	return err
 }
 
-func (fr FileRotator) nthBackupPath(n int) string {
+func nthBackupPath(path string, n int) string {
 	if n == 0 {
-		return fr.path
+		return path
 	}
-	ext := filepath.Ext(fr.path)
-	name := strings.TrimSuffix(fr.path, ext)
+	ext := filepath.Ext(path)
+	name := strings.TrimSuffix(path, ext)
 
 	return fmt.Sprintf("%v.%v%v", name, n, ext)
 }
+
+// closeFile closes f unless it is nil
+func closeFile(f file) error {
+	if f == nil {
+		return nil
+	}
+	return f.Close()
+}
+
+// OptHeader writes header at the start of every new or truncated file, e.g. a
+// byte order mark.
+func OptHeader(header []byte) func(o *options) {
+	return func(o *options) {
+		o.header = header
+	}
+}
+
+// createFile creates or truncates path and opens it for appending with the
+// io mode of the rotator, like most loggers open their files.
+func (o *options) createFile(path string) (file, error) {
+	var f file
+	var err error
+	if o.preallocate > 0 {
+		f, err = openPreallocated(path, o.ioMode, o.preallocate)
+	} else {
+		f, err = openFile(path, o.ioMode, os.O_TRUNC)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := o.writeHeader(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// reopenFile closes f and opens path for appending, creating it if needed.
+// The header is written if the file is empty, e.g. after it was recreated.
+func (o *options) reopenFile(f file, path string) (file, error) {
+	if err := closeFile(f); err != nil {
+		return nil, fmt.Errorf("failed to close current file %v: %w", path, err)
+	}
+	nf, err := openFile(path, o.ioMode, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reopen file %v: %w", path, err)
+	}
+	if len(o.header) > 0 {
+		fi, err := os.Stat(path)
+		if err == nil && fi.Size() == 0 {
+			err = o.writeHeader(nf)
+		}
+		if err != nil {
+			nf.Close()
+			return nil, err
+		}
+	}
+	return nf, nil
+}
+
+func (o *options) writeHeader(f file) error {
+	if len(o.header) == 0 {
+		return nil
+	}
+	if _, err := f.Write(o.header); err != nil {
+		return fmt.Errorf("failed to write header to %v: %w", f.Name(), err)
+	}
+	return nil
+}
+
+// firstFreePath returns the first path returned by nth that does not exist
+// yet, neither compressed nor uncompressed.
+func firstFreePath(nth func(i int) string) (string, error) {
+	for i := 0; ; i++ {
+		p := nth(i)
+		taken, err := exists(p)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			taken, err = exists(p + compressExt)
+			if err != nil {
+				return "", err
+			}
+		}
+		if !taken {
+			return p, nil
+		}
+	}
+}
+
+func exists(p string) (bool, error) {
+	_, err := os.Lstat(p)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// backupList tracks the backups created by a rotator, oldest first.
+type backupList []string
+
+// prune removes all but the newest keep backups, compressed or not, and
+// applies the retention policy of o.
+func (bl *backupList) prune(keep int, o *options) error {
+	for len(*bl) > keep {
+		if err := removeBackup((*bl)[0]); err != nil {
+			return err
+		}
+		*bl = (*bl)[1:]
+	}
+
+	newestFirst := make([]string, len(*bl))
+	for i := range newestFirst {
+		newestFirst[i] = bl.newest(i)
+	}
+	n, err := o.retain(newestFirst)
+	*bl = (*bl)[len(*bl)-n:]
+	return err
+}
+
+// newest returns the nth newest backup, or "" if there is none.
+func (bl backupList) newest(n int) string {
+	if n >= len(bl) {
+		return ""
+	}
+	return bl[len(bl)-1-n]
+}
@@ -0,0 +1,747 @@
+package rotator
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "rotator")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	return dir
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %v: %v", path, err)
+	}
+	return string(b)
+}
+
+func TestCopyTruncateRotator(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	r := NewCopyTruncateRotator(path, 2, 0)
+
+	w, err := r.Rotate()
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	for _, l := range []string{"one\n", "two\n", "three\n"} {
+		if _, err := w.Write([]byte(l)); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		nw, err := r.Rotate()
+		if err != nil {
+			t.Fatalf("Failed to rotate: %v", err)
+		}
+		if nw != w {
+			t.Errorf("Expecting the same writer after copytruncate")
+		}
+	}
+	w.Write([]byte("four\n"))
+
+	expected := map[string]string{
+		path:                   "four\n",
+		nthBackupPath(path, 1): "three\n",
+		nthBackupPath(path, 2): "two\n",
+	}
+	for p, c := range expected {
+		if got := readFile(t, p); got != c {
+			t.Errorf("Expecting %v to contain %q, got %q", p, c, got)
+		}
+	}
+}
+
+func TestCopyTruncateRotatorDelay(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	r := NewCopyTruncateRotator(path, 1, 50*time.Millisecond)
+
+	w, _ := r.Rotate()
+	w.Write([]byte("copied\n"))
+	r.Rotate()
+	w.Write([]byte("lost\n"))
+	r.truncating.Wait()
+	w.Write([]byte("kept\n"))
+
+	if got := readFile(t, path); got != "kept\n" {
+		t.Errorf("Expecting lines written before truncate to be lost, got %q", got)
+	}
+	if got := readFile(t, nthBackupPath(path, 1)); got != "copied\n" {
+		t.Errorf("Expecting backup to contain the copied line, got %q", got)
+	}
+}
+
+func TestDateExtRotator(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	r := NewDateExtRotator(path, 2, "")
+
+	for i := 0; i < 4; i++ {
+		if _, err := r.Rotate(); err != nil {
+			t.Fatalf("Failed to rotate: %v", err)
+		}
+	}
+
+	date := path + time.Now().Format(DefaultDateExtFormat)
+	backups, _ := filepath.Glob(path + "-*")
+	if len(backups) != 2 || backups[0] != date+".1" || backups[1] != date+".2" {
+		t.Errorf("Expecting backups %v.1 and %v.2, got %v", date, date, backups)
+	}
+}
+
+func TestTimestampRotator(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	r := NewTimestampRotator(filepath.Join(dir, "app.log"), 1, "2006")
+
+	for i := 0; i < 3; i++ {
+		if _, err := r.Rotate(); err != nil {
+			t.Fatalf("Failed to rotate: %v", err)
+		}
+	}
+
+	year := time.Now().Format("2006")
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	expected := []string{
+		filepath.Join(dir, "app-"+year+".1.log"),
+		filepath.Join(dir, "app-"+year+".2.log"),
+	}
+	if len(files) != len(expected) || files[0] != expected[0] || files[1] != expected[1] {
+		t.Errorf("Expecting files %v, got %v", expected, files)
+	}
+}
+
+func TestSymlinkRotator(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "current.log")
+	r := NewSymlinkRotator(path, 1)
+
+	for i := 0; i < 3; i++ {
+		w, err := r.Rotate()
+		if err != nil {
+			t.Fatalf("Failed to rotate: %v", err)
+		}
+		w.Write([]byte("line\n"))
+	}
+
+	target, err := os.Readlink(path)
+	if err != nil {
+		t.Fatalf("Expecting %v to be a symlink: %v", path, err)
+	}
+	if target != "current.3.log" {
+		t.Errorf("Expecting symlink to point to current.3.log, got %v", target)
+	}
+	if got := readFile(t, path); got != "line\n" {
+		t.Errorf("Expecting line written through the symlink, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "current.1.log")); !os.IsNotExist(err) {
+		t.Errorf("Expecting current.1.log to be removed, err: %v", err)
+	}
+}
+
+func TestSymlinkRotatorReopen(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "current.log")
+	r := NewSymlinkRotator(path, 3, OptCompress(false))
+
+	for i := 0; i < 2; i++ {
+		w, err := r.Rotate()
+		if err != nil {
+			t.Fatalf("Failed to rotate: %v", err)
+		}
+		fmt.Fprintf(w, "line %v\n", i)
+	}
+	w, err := r.Reopen()
+	if err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	w.Write([]byte("reopened\n"))
+	if _, err := r.Rotate(); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	r.waitCompress()
+
+	// The file reopened is rotated and compressed, not the link
+	target, err := os.Readlink(path)
+	if err != nil {
+		t.Fatalf("Expecting %v to be a symlink: %v", path, err)
+	}
+	if target != "current.3.log" {
+		t.Errorf("Expecting symlink to point to current.3.log, got %v", target)
+	}
+	expected := []string{
+		path,
+		filepath.Join(dir, "current.1.log") + compressExt,
+		filepath.Join(dir, "current.2.log") + compressExt,
+		filepath.Join(dir, "current.3.log"),
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	sort.Strings(expected)
+	if strings.Join(files, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expecting files %v, got %v", expected, files)
+	}
+}
+
+func TestKeepZero(t *testing.T) {
+	for _, scheme := range []string{SchemeCreate, SchemeCopyTruncate, SchemeDateExt, SchemeTimestamp, SchemeSymlink} {
+		t.Run(scheme, func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "app.log")
+			r, err := NewRotator(path, Config{Scheme: scheme})
+			if err != nil {
+				t.Fatalf("Failed to create rotator: %v", err)
+			}
+			defer r.Close()
+
+			link := filepath.Join(dir, "link")
+			for i := 0; i < 3; i++ {
+				w, err := r.Rotate()
+				if err != nil {
+					t.Fatalf("Failed to rotate: %v", err)
+				}
+				line := fmt.Sprintf("line %v\n", i)
+				if _, err := w.Write([]byte(line)); err != nil {
+					t.Fatalf("Failed to write: %v", err)
+				}
+
+				// The file written to has to stay reachable by its name
+				name := w.(file).Name()
+				if got := readFile(t, name); got != line {
+					t.Errorf("Expecting %v to contain %q, got %q", name, line, got)
+				}
+
+				// Without backups, create and copytruncate truncate the file
+				// in place, so a hardlink to it sees every line
+				if scheme != SchemeCreate && scheme != SchemeCopyTruncate {
+					continue
+				}
+				if i == 0 {
+					if err := os.Link(name, link); err != nil {
+						t.Fatalf("Failed to link %v: %v", name, err)
+					}
+				}
+				if got := readFile(t, link); got != line {
+					t.Errorf("Expecting %v to be truncated in place, got %q instead of %q", name, got, line)
+				}
+			}
+		})
+	}
+}
+
+func TestRemove(t *testing.T) {
+	for _, scheme := range []string{SchemeCreate, SchemeCopyTruncate, SchemeDateExt, SchemeTimestamp, SchemeSymlink} {
+		t.Run(scheme, func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+			archive := filepath.Join(dir, "archive")
+			r, err := NewRotator(filepath.Join(dir, "app.log"), Config{Scheme: scheme, Keep: 2, Compress: true, ArchiveDir: archive})
+			if err != nil {
+				t.Fatalf("Failed to create rotator: %v", err)
+			}
+			w, err := NewWriter(r, Config{Scheme: scheme})
+			if err != nil {
+				t.Fatalf("Failed to create writer: %v", err)
+			}
+			for i := 0; i < 3; i++ {
+				fmt.Fprintf(w, "line %v\n", i)
+				if err := w.Rotate(); err != nil {
+					t.Fatalf("Failed to rotate: %v", err)
+				}
+			}
+			if err := w.Remove(); err == nil {
+				t.Errorf("Expecting remove to fail before the writer is closed")
+			}
+			w.Close()
+
+			if err := w.Remove(); err != nil {
+				t.Fatalf("Failed to remove: %v", err)
+			}
+			files, _ := filepath.Glob(filepath.Join(dir, "*"))
+			archived, _ := filepath.Glob(filepath.Join(archive, "*"))
+			if len(files) != 1 || files[0] != archive || len(archived) != 0 {
+				t.Errorf("Expecting all files to be removed, got %v and %v", files, archived)
+			}
+		})
+	}
+}
+
+func TestFileRotatorCompress(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	r := NewFileRotator(path, 3, OptCompress(true))
+
+	for i := 0; i < 4; i++ {
+		w, err := r.Rotate()
+		if err != nil {
+			t.Fatalf("Failed to rotate: %v", err)
+		}
+		fmt.Fprintf(w, "line %v\n", i)
+	}
+	r.waitCompress()
+
+	expected := []string{
+		path,
+		nthBackupPath(path, 1),
+		nthBackupPath(path, 2) + compressExt,
+		nthBackupPath(path, 3) + compressExt,
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	sort.Strings(expected)
+	if strings.Join(files, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expecting files %v, got %v", expected, files)
+	}
+
+	f, err := os.Open(nthBackupPath(path, 3) + compressExt)
+	if err != nil {
+		t.Fatalf("Failed to open compressed backup: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Failed to read compressed backup: %v", err)
+	}
+	b, _ := ioutil.ReadAll(zr)
+	if string(b) != "line 0\n" {
+		t.Errorf("Expecting compressed backup to contain %q, got %q", "line 0\n", b)
+	}
+}
+
+func TestWriterConcurrent(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	w, err := NewWriter(NewFileRotator(path, 100), Config{Size: 1000, SyncBytes: 500})
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := w.Write([]byte("0123456789\n")); err != nil {
+					t.Errorf("Failed to write: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := w.Close(); err != nil {
+		t.Errorf("Failed to close writer: %v", err)
+	}
+	if _, err := w.Write([]byte("closed\n")); err != os.ErrClosed {
+		t.Errorf("Expecting write after close to fail with %v, got %v", os.ErrClosed, err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	var total int
+	for _, f := range files {
+		c := readFile(t, f)
+		if strings.Count(c, "0123456789\n")*11 != len(c) {
+			t.Errorf("Expecting only whole lines in %v, got %q", f, c)
+		}
+		total += len(c)
+	}
+	if total != 10*100*11 {
+		t.Errorf("Expecting %v bytes written, got %v", 10*100*11, total)
+	}
+}
+
+// syncRotator records the rotations and the syncs of the files it rotates to
+type syncRotator struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (sr *syncRotator) Rotate() (io.Writer, error) {
+	sr.record("rotate")
+	return &syncFile{sr: sr}, nil
+}
+
+func (sr *syncRotator) Close() error {
+	return nil
+}
+
+func (sr *syncRotator) record(e string) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.events = append(sr.events, e)
+}
+
+// syncs returns the number of syncs recorded
+func (sr *syncRotator) syncs() int {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	n := 0
+	for _, e := range sr.events {
+		if e == "sync" {
+			n++
+		}
+	}
+	return n
+}
+
+type syncFile struct {
+	sr *syncRotator
+}
+
+func (sf *syncFile) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (sf *syncFile) Sync() error {
+	sf.sr.record("sync")
+	return nil
+}
+
+func TestSyncBytes(t *testing.T) {
+	sr := &syncRotator{}
+	w, err := NewWriter(sr, Config{SyncBytes: 10})
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	defer w.Close()
+
+	w.Write([]byte("line\n"))
+	if n := sr.syncs(); n != 0 {
+		t.Errorf("Expecting no sync before %v bytes, got %v", 10, n)
+	}
+	w.Write([]byte("line\n"))
+	if n := sr.syncs(); n != 1 {
+		t.Errorf("Expecting a sync after %v bytes, got %v", 10, n)
+	}
+}
+
+func TestSyncInterval(t *testing.T) {
+	sr := &syncRotator{}
+	w, err := NewWriter(sr, Config{SyncInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	w.Write([]byte("line\n"))
+	for i := 0; i < 100 && sr.syncs() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sr.syncs() == 0 {
+		t.Errorf("Expecting the file to be synced every interval")
+	}
+
+	// Close syncs once more and stops syncing every interval
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	n := sr.syncs()
+	time.Sleep(50 * time.Millisecond)
+	if got := sr.syncs(); got != n {
+		t.Errorf("Expecting no syncs after close, got %v more", got-n)
+	}
+}
+
+func TestSyncOnRotate(t *testing.T) {
+	sr := &syncRotator{}
+	w, err := NewWriter(sr, Config{SyncOnRotate: true})
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	defer w.Close()
+
+	w.Write([]byte("line\n"))
+	if err := w.Rotate(); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	sr.mu.Lock()
+	events := strings.Join(sr.events, ",")
+	sr.mu.Unlock()
+	if events != "rotate,sync,rotate" {
+		t.Errorf("Expecting the file to be synced before it is rotated, got %v", events)
+	}
+}
+
+type timedRotator struct {
+	rotated []time.Time
+}
+
+func (tr *timedRotator) Rotate() (io.Writer, error) {
+	tr.rotated = append(tr.rotated, time.Now())
+	return ioutil.Discard, nil
+}
+
+func (tr *timedRotator) Close() error {
+	return nil
+}
+
+func TestAppender(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	w, err := NewWriter(NewFileRotator(path, 100), Config{Size: 1000})
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		var dest io.Writer = w
+		if i > 0 {
+			a := w.NewAppender()
+			defer a.Close()
+			dest = a
+		}
+		wg.Add(1)
+		go func(dest io.Writer) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := dest.Write([]byte("0123456789\n")); err != nil {
+					t.Errorf("Failed to write: %v", err)
+				}
+			}
+		}(dest)
+	}
+	wg.Wait()
+	if err := w.Close(); err != nil {
+		t.Errorf("Failed to close writer: %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) < 4 {
+		t.Errorf("Expecting the appenders to rotate the file, got %v", files)
+	}
+	var total int
+	for _, f := range files {
+		c := readFile(t, f)
+		if strings.Count(c, "0123456789\n")*11 != len(c) {
+			t.Errorf("Expecting only whole lines in %v, got %q", f, c)
+		}
+		total += len(c)
+	}
+	if total != 4*100*11 {
+		t.Errorf("Expecting %v bytes written, got %v", 4*100*11, total)
+	}
+}
+
+// skipUnsupported skips io modes the file system of the temp dir does not
+// support, e.g. tmpfs rejects O_DIRECT with EINVAL.
+func skipUnsupported(t *testing.T, mode string, err error) {
+	t.Helper()
+	if mode == IOModeDirect && errors.Is(err, syscall.EINVAL) {
+		t.Skipf("File system does not support io mode %v: %v", mode, err)
+	}
+}
+
+func TestIOModes(t *testing.T) {
+	for _, mode := range ioModes {
+		t.Run(mode, func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "app.log")
+			w, err := NewWriter(NewCopyTruncateRotator(path, 1, 0, OptIOMode(mode)), Config{IOMode: mode, SyncBytes: 3000})
+			skipUnsupported(t, mode, err)
+			if err != nil {
+				t.Fatalf("Failed to create writer with io mode %v: %v", mode, err)
+			}
+
+			line := strings.Repeat("0123456789", 10) + "\n"
+			for i := 0; i < 100; i++ {
+				if _, err := w.Write([]byte(line)); err != nil {
+					t.Fatalf("Failed to write with io mode %v: %v", mode, err)
+				}
+				if i == 49 {
+					if err := w.Rotate(); err != nil {
+						t.Fatalf("Failed to rotate with io mode %v: %v", mode, err)
+					}
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Errorf("Failed to close writer with io mode %v: %v", mode, err)
+			}
+
+			// Partial blocks written with O_DIRECT end up in the truncated file
+			c := readFile(t, nthBackupPath(path, 1)) + readFile(t, path)
+			if c != strings.Repeat(line, 100) {
+				t.Errorf("Expecting 100 lines with io mode %v, got %v bytes", mode, len(c))
+			}
+		})
+	}
+}
+
+func TestPreallocateAndHoles(t *testing.T) {
+	cases := []struct {
+		mode     string
+		prealloc int64
+	}{
+		{IOModeBuffered, 0},
+		{IOModeBuffered, 65536},
+		{IOModeSync, 65536},
+		{IOModeDirect, 0},
+		{IOModeMmap, 0},
+		{IOModeMmap, 65536},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%v/%v", c.mode, c.prealloc), func(t *testing.T) {
+			dir := tempDir(t)
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "app.log")
+			r := NewFileRotator(path, 1, OptIOMode(c.mode), OptPreallocate(c.prealloc))
+			w, err := NewWriter(r, Config{IOMode: c.mode, Preallocate: c.prealloc})
+			skipUnsupported(t, c.mode, err)
+			if err != nil {
+				t.Fatalf("Failed to create writer with io mode %v: %v", c.mode, err)
+			}
+
+			if _, err := w.Write([]byte("abc\n")); err != nil {
+				t.Fatalf("Failed to write with io mode %v: %v", c.mode, err)
+			}
+			if c.prealloc > 0 {
+				if fi, err := os.Stat(path); err != nil || fi.Size() != c.prealloc {
+					t.Errorf("Expecting %v to be preallocated to %v bytes with io mode %v, got %v", path, c.prealloc, c.mode, fi)
+				}
+			}
+			if err := w.Hole(10); err != nil {
+				t.Fatalf("Failed to make hole with io mode %v: %v", c.mode, err)
+			}
+			if _, err := w.Write([]byte("def\n")); err != nil {
+				t.Fatalf("Failed to write with io mode %v: %v", c.mode, err)
+			}
+			if err := w.Close(); err != nil {
+				t.Errorf("Failed to close writer with io mode %v: %v", c.mode, err)
+			}
+
+			expected := "abc\n" + strings.Repeat("\x00", 10) + "def\n"
+			if content := readFile(t, path); content != expected {
+				t.Errorf("Expecting %q with io mode %v and preallocation %v, got %q", expected, c.mode, c.prealloc, content)
+			}
+		})
+	}
+}
+
+func TestHeader(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	c := Config{Keep: 1, Scheme: SchemeCopyTruncate, TruncateDelay: 20 * time.Millisecond, Header: []byte("H")}
+	r, err := NewRotator(path, c)
+	if err != nil {
+		t.Fatalf("Failed to create rotator: %v", err)
+	}
+	w, err := NewWriter(r, c)
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	defer w.Close()
+
+	// The header follows the delayed truncate instead of being truncated with it
+	w.Write([]byte("a"))
+	if err := w.Rotate(); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	r.(*CopyTruncateRotator).truncating.Wait()
+	w.Write([]byte("b"))
+	if got := readFile(t, path); got != "Hb" {
+		t.Errorf("Expecting the truncated file to start with the header, got %q", got)
+	}
+
+	// A recreated file gets the header when it is reopened
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Failed to remove %v: %v", path, err)
+	}
+	if err := w.Reopen(); err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	w.Write([]byte("c"))
+	if got := readFile(t, path); got != "Hc" {
+		t.Errorf("Expecting the reopened file to start with the header, got %q", got)
+	}
+}
+
+func TestGroupStagger(t *testing.T) {
+	var rs []*timedRotator
+	var ws []*Writer
+	for i := 0; i < 4; i++ {
+		r := &timedRotator{}
+		w, err := NewWriter(r, Config{})
+		if err != nil {
+			t.Fatalf("Failed to create writer: %v", err)
+		}
+		rs = append(rs, r)
+		ws = append(ws, w)
+	}
+
+	// The delays are recorded instead of slept, so timing does not matter
+	var mu sync.Mutex
+	var delays []time.Duration
+	g := NewGroup(ws, 200*time.Millisecond)
+	g.sleep = func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		delays = append(delays, d)
+	}
+	if err := g.RotateAll(); err != nil {
+		t.Fatalf("Failed to rotate group: %v", err)
+	}
+	for i, r := range rs {
+		if len(r.rotated) != 2 {
+			t.Fatalf("Expecting writer %v to be rotated once by the group, got %v", i, len(r.rotated)-1)
+		}
+	}
+
+	sort.Slice(delays, func(i, j int) bool { return delays[i] < delays[j] })
+	expected := []time.Duration{0, 50 * time.Millisecond, 100 * time.Millisecond, 150 * time.Millisecond}
+	if fmt.Sprint(delays) != fmt.Sprint(expected) {
+		t.Errorf("Expecting rotations delayed by %v, got %v", expected, delays)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	archive := filepath.Join(dir, "archive")
+
+	for _, r := range []Rotator{
+		NewFileRotator(path, 10, OptArchiveDir(archive), OptMaxBytes(25)),
+		NewDateExtRotator(path, 10, "", OptArchiveDir(archive), OptMaxBytes(25)),
+	} {
+		for i := 0; i < 5; i++ {
+			w, err := r.Rotate()
+			if err != nil {
+				t.Fatalf("Failed to rotate: %v", err)
+			}
+			w.Write([]byte("0123456789\n"))
+		}
+		r.Close()
+
+		files, _ := filepath.Glob(filepath.Join(archive, "*"))
+		if len(files) != 2 {
+			t.Errorf("Expecting 2 backups of 11 bytes to be kept within 25 bytes, got %v", files)
+		}
+		os.RemoveAll(archive)
+	}
+}
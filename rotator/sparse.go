@@ -0,0 +1,146 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rotator
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// OptPreallocate preallocates new files to size bytes with fallocate, they
+// are written from the start and read as NUL bytes past the written data
+// until they are truncated to it on rotation.
+func OptPreallocate(size int64) func(o *options) {
+	return func(o *options) {
+		o.preallocate = size
+	}
+}
+
+type holer interface {
+	hole(n int64) error
+}
+
+// makeHole extends f by n bytes without writing them
+func makeHole(f file, n int64) error {
+	switch f := f.(type) {
+	case holer:
+		return f.hole(n)
+	case *os.File:
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		return f.Truncate(fi.Size() + n)
+	default:
+		return fmt.Errorf("file %T does not support holes", f)
+	}
+}
+
+func openPreallocated(path, mode string, size int64) (file, error) {
+	var flag int
+	switch mode {
+	case "", IOModeBuffered:
+	case IOModeSync:
+		flag = os.O_SYNC
+	case IOModeDSync:
+		flag = oDSync
+	case IOModeMmap:
+		return openMmap(path, os.O_TRUNC, size)
+	default:
+		return nil, fmt.Errorf("io mode %v does not support preallocation", mode)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+	p := &preallocFile{f: f, prealloc: size}
+	if err := p.preallocate(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// preallocFile writes a preallocated file at its own offset instead of
+// appending to it.
+type preallocFile struct {
+	mu       sync.Mutex
+	f        *os.File
+	off      int64
+	prealloc int64
+}
+
+func (p *preallocFile) preallocate() error {
+	if err := fallocate(p.f, p.prealloc); err != nil {
+		return fmt.Errorf("failed to preallocate %v: %w", p.f.Name(), err)
+	}
+	return nil
+}
+
+func (p *preallocFile) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n, err := p.f.WriteAt(b, p.off)
+	p.off += int64(n)
+	return n, err
+}
+
+func (p *preallocFile) hole(n int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.off += n
+	return nil
+}
+
+func (p *preallocFile) Name() string {
+	return p.f.Name()
+}
+
+func (p *preallocFile) Sync() error {
+	return p.f.Sync()
+}
+
+// Truncate preallocates the file again, like a logger reopening it
+func (p *preallocFile) Truncate(size int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.f.Truncate(size); err != nil {
+		return err
+	}
+	p.off = size
+	if size < p.prealloc {
+		return p.preallocate()
+	}
+	return nil
+}
+
+func (p *preallocFile) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	err := p.f.Truncate(p.off)
+	if cerr := p.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rotator
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// SymlinkRotator keeps path as a symbolic link to the live file and switches
+// it to a newly created file on every rotation, e.g. current.log pointing to
+// current.1.log, then current.2.log and so on. Files are never renamed.
+type SymlinkRotator struct {
+	path string
+	keep int
+
+	n       int
+	current file
+	backups backupList
+	*options
+}
+
+func NewSymlinkRotator(path string, keep int, opts ...Opt) *SymlinkRotator {
+	return &SymlinkRotator{path: path, keep: keep, options: newOptions(opts)}
+}
+
+func (sr *SymlinkRotator) Rotate() (io.Writer, error) {
+	log.Printf("Rotating %v", sr.path)
+	if sr.current != nil {
+		if err := sr.current.Close(); err != nil {
+			return nil, fmt.Errorf("failed to close current file %v: %w", sr.current.Name(), err)
+		}
+		sr.waitCompress()
+		if err := sr.archive(sr.current.Name()); err != nil {
+			return nil, fmt.Errorf("failed to archive %v: %w", sr.current.Name(), err)
+		}
+		sr.backups = append(sr.backups, sr.archived(sr.current.Name()))
+		if err := sr.backups.prune(sr.keep, sr.options); err != nil {
+			return nil, fmt.Errorf("failed to remove old log files: %w", err)
+		}
+		sr.compressBackup(sr.backups.newest(0), sr.backups.newest(1))
+	}
+
+	p, err := firstFreePath(func(i int) string {
+		sr.n++
+		return nthBackupPath(sr.path, sr.n)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find a new file name for %v: %w", sr.path, err)
+	}
+
+	f, err := sr.createFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file %v: %w", p, err)
+	}
+	sr.current = f
+
+	// Switch the link atomically by renaming a new link over it
+	tmp := sr.path + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(filepath.Base(p), tmp); err != nil {
+		return nil, fmt.Errorf("failed to create symlink %v: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, sr.path); err != nil {
+		return nil, fmt.Errorf("failed to switch symlink %v to %v: %w", sr.path, p, err)
+	}
+	return f, nil
+}
+
+// Reopen opens the file path links to, which might have been switched. The
+// target is opened rather than the link, so it is the file rotated next.
+func (sr *SymlinkRotator) Reopen() (io.Writer, error) {
+	target, err := os.Readlink(sr.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve symlink %v: %w", sr.path, err)
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(sr.path), target)
+	}
+	f, err := sr.reopenFile(sr.current, target)
+	if err != nil {
+		return nil, err
+	}
+	sr.current = f
+	return f, nil
+}
+
+func (sr *SymlinkRotator) Close() error {
+	sr.waitCompress()
+	return closeFile(sr.current)
+}
+
+// Remove removes the link along with the files written
+func (sr *SymlinkRotator) Remove() error {
+	files := append([]string{sr.path}, sr.backups...)
+	if sr.current != nil {
+		files = append(files, sr.current.Name())
+	}
+	return removeFiles(files...)
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package rotator
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const DefaultTimestampFormat = "2006-01-02-15"
+
+// TimestampRotator never renames files, instead every rotation opens a new
+// file with the current time in its name, e.g. app-2024-01-01-13.log for the
+// path app.log. A counter is added when the name is already taken.
+type TimestampRotator struct {
+	path   string
+	keep   int
+	format string
+
+	name    string
+	n       int
+	current file
+	backups backupList
+	*options
+}
+
+func NewTimestampRotator(path string, keep int, format string, opts ...Opt) *TimestampRotator {
+	if format == "" {
+		format = DefaultTimestampFormat
+	}
+	return &TimestampRotator{path: path, keep: keep, format: format, options: newOptions(opts)}
+}
+
+func (tr *TimestampRotator) Rotate() (io.Writer, error) {
+	ext := filepath.Ext(tr.path)
+	name := strings.TrimSuffix(tr.path, ext)
+
+	// Count up within the same period, so names of removed files are not reused
+	if n := fmt.Sprintf("%v-%v%v", name, time.Now().Format(tr.format), ext); n != tr.name {
+		tr.name = n
+		tr.n = 0
+	}
+	p, err := firstFreePath(func(int) string {
+		tr.n++
+		return nthBackupPath(tr.name, tr.n-1)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find a new file name for %v: %w", tr.path, err)
+	}
+
+	log.Printf("Rotating %v to %v", tr.path, p)
+	if tr.current != nil {
+		if err := tr.current.Close(); err != nil {
+			return nil, fmt.Errorf("failed to close current file %v: %w", tr.current.Name(), err)
+		}
+		tr.waitCompress()
+		if err := tr.archive(tr.current.Name()); err != nil {
+			return nil, fmt.Errorf("failed to archive %v: %w", tr.current.Name(), err)
+		}
+		tr.backups = append(tr.backups, tr.archived(tr.current.Name()))
+		if err := tr.backups.prune(tr.keep, tr.options); err != nil {
+			return nil, fmt.Errorf("failed to remove old log files: %w", err)
+		}
+		tr.compressBackup(tr.backups.newest(0), tr.backups.newest(1))
+	}
+
+	f, err := tr.createFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file %v: %w", p, err)
+	}
+	tr.current = f
+	return f, nil
+}
+
+func (tr *TimestampRotator) Reopen() (io.Writer, error) {
+	f, err := tr.reopenFile(tr.current, tr.current.Name())
+	if err != nil {
+		return nil, err
+	}
+	tr.current = f
+	return f, nil
+}
+
+func (tr *TimestampRotator) Close() error {
+	tr.waitCompress()
+	return closeFile(tr.current)
+}
+
+// Remove removes the files written, nothing is ever written at the path itself
+func (tr *TimestampRotator) Remove() error {
+	files := append([]string{}, tr.backups...)
+	if tr.current != nil {
+		files = append(files, tr.current.Name())
+	}
+	return removeFiles(files...)
+}
@@ -18,7 +18,12 @@
 package rotator
 
 import (
+	"bytes"
+	"fmt"
 	"io"
+	"log"
+	"os"
+	"sync"
 	"time"
 )
 
@@ -26,26 +31,113 @@ type Config struct {
 	Keep     int
 	Duration time.Duration
 	Size     int64
+	// Lines is the number of lines written before the file is rotated
+	Lines int64
+
+	// Scheme selects how files are rotated, see NewRotator
+	Scheme string
+	// TruncateDelay is the time between copy and truncate for copytruncate rotation
+	TruncateDelay time.Duration
+	// DateFormat is the time layout used in file names by the dateext and timestamp schemes
+	DateFormat string
+	// Compress gzips rotated files, with DelayCompress the newest one is left uncompressed
+	Compress      bool
+	DelayCompress bool
+	// ArchiveDir is where rotated files are moved to, next to the live file if empty
+	ArchiveDir string
+	// MaxAge and MaxBytes remove rotated files by age and by their total size
+	MaxAge   time.Duration
+	MaxBytes int64
+	// IOMode selects how the file is opened and written, see OptIOMode
+	IOMode string
+	// Preallocate is the size new files are preallocated to, see OptPreallocate
+	Preallocate int64
+	// Header is written at the start of every new or truncated file by the
+	// rotator, e.g. a byte order mark, see OptHeader
+	Header []byte
+
+	// SyncBytes, SyncInterval and SyncOnRotate control when written data is
+	// fsynced, by default it is left to the page cache.
+	SyncBytes    int64
+	SyncInterval time.Duration
+	SyncOnRotate bool
+
+	// OnRotate is called with every rotation of the file, while writes are blocked
+	OnRotate func(e Event)
 }
 
+// Event describes a rotation of the file written by a Writer
+type Event struct {
+	Time   time.Time
+	Scheme string
+	// Bytes and Lines written to the file that was rotated
+	Bytes, Lines int64
+}
+
+type syncer interface {
+	Sync() error
+}
+
+// Writer writes to the file of a Rotator and rotates it by size or time, it
+// is safe for concurrent use.
 type Writer struct {
-	w io.Writer
-	r Rotator
-	c Config
+	mu sync.Mutex
+	w  io.Writer
+	r  Rotator
+	c  Config
 
-	rt   time.Time
-	size int64
+	rt       time.Time
+	size     int64
+	lines    int64
+	unsynced int64
+	written  int64
+	closed   bool
+	done     chan struct{}
+	// generation counts the files written to, so appenders know when to reopen
+	generation int
 }
 
 func NewWriter(r Rotator, c Config) (*Writer, error) {
-	w := &Writer{r: r, c: c}
+	w := &Writer{r: r, c: c, done: make(chan struct{})}
 	if err := w.Rotate(); err != nil {
 		return nil, err
 	}
+	if c.SyncInterval > 0 {
+		go w.syncEvery(c.SyncInterval)
+	}
 	return w, nil
 }
 
 func (w *Writer) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	if err := w.maybeRotate(int64(len(b))); err != nil {
+		return 0, err
+	}
+
+	n, err := w.w.Write(b)
+	w.size += int64(n)
+	w.lines += int64(bytes.Count(b[:n], []byte{'\n'}))
+	w.unsynced += int64(n)
+	w.written += int64(n)
+	if err != nil {
+		return n, err
+	}
+
+	if w.c.SyncBytes > 0 && w.unsynced >= w.c.SyncBytes {
+		if err := w.sync(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// maybeRotate rotates the file if writing n bytes would exceed any of the limits
+func (w *Writer) maybeRotate(n int64) error {
 	now := time.Now()
 
 	if w.c.Duration > 0 {
@@ -54,30 +146,199 @@ func (w *Writer) Write(b []byte) (int, error) {
 		}
 
 		if now.After(w.rt) {
-			if err := w.Rotate(); err != nil {
-				return 0, err
+			if err := w.rotate(); err != nil {
+				return err
 			}
 		}
 	}
 
-	if w.c.Size > 0 && w.size+int64(len(b)) > w.c.Size {
-		if err := w.Rotate(); err != nil {
-			return 0, err
+	if w.c.Size > 0 && w.size+n > w.c.Size {
+		if err := w.rotate(); err != nil {
+			return err
 		}
 	}
 
-	n, err := w.w.Write(b)
-	w.size += int64(n)
-	return n, err
+	if w.c.Lines > 0 && w.lines >= w.c.Lines {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (w *Writer) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	return w.rotate()
+}
+
+func (w *Writer) rotate() error {
+	if w.c.SyncOnRotate && w.w != nil {
+		if err := w.sync(); err != nil {
+			return err
+		}
+	}
+
 	nw, err := w.r.Rotate()
 	if err != nil {
 		return err
 	}
+	if w.w != nil && w.c.OnRotate != nil {
+		scheme := w.c.Scheme
+		if scheme == "" {
+			scheme = SchemeCreate
+		}
+		w.c.OnRotate(Event{Time: time.Now(), Scheme: scheme, Bytes: w.size, Lines: w.lines})
+	}
 	w.w = nw
+	w.generation++
 	w.size = 0
+	w.lines = 0
+	w.unsynced = 0
 	w.rt = time.Time{}
 	return nil
 }
+
+// Reopen makes the writer continue with the file currently at the path of
+// the live file, e.g. after the file was deleted and recreated.
+func (w *Writer) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	ro, ok := w.r.(Reopener)
+	if !ok {
+		return fmt.Errorf("rotator %T does not support reopening files", w.r)
+	}
+	nw, err := ro.Reopen()
+	if err != nil {
+		return err
+	}
+	w.w = nw
+	w.generation++
+	return nil
+}
+
+// Remove removes the files written by a closed writer, the live file and its
+// backups.
+func (w *Writer) Remove() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.closed {
+		return fmt.Errorf("writer must be closed to remove its files")
+	}
+	rm, ok := w.r.(Remover)
+	if !ok {
+		return fmt.Errorf("rotator %T does not support removing files", w.r)
+	}
+	return rm.Remove()
+}
+
+// Written returns the number of bytes written through the writer and its
+// appenders to all of its files, holes are not counted as they are not written.
+func (w *Writer) Written() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.written
+}
+
+// Name returns the name of the file currently written to, which differs from
+// the path of the logfile for the timestamp and symlink schemes.
+func (w *Writer) Name() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if f, ok := w.w.(file); ok {
+		return f.Name()
+	}
+	return ""
+}
+
+// Hole extends the file by n bytes without writing them, leaving a sparse
+// hole that reads as NUL bytes, like a file written at an offset past its end.
+// Appenders write without the writer's lock, so holes would overwrite their
+// data and must not be combined with them. Holes count towards the size the
+// file is rotated at but not towards Written.
+func (w *Writer) Hole(n int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	if err := w.maybeRotate(n); err != nil {
+		return err
+	}
+	f, ok := w.w.(file)
+	if !ok {
+		return fmt.Errorf("rotator %T does not support holes", w.r)
+	}
+	if err := makeHole(f, n); err != nil {
+		return fmt.Errorf("failed to make hole in %v: %w", f.Name(), err)
+	}
+	w.size += n
+	return nil
+}
+
+// Flush commits the data written to the current file to stable storage.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	return w.sync()
+}
+
+func (w *Writer) sync() error {
+	s, ok := w.w.(syncer)
+	if !ok {
+		return nil
+	}
+	w.unsynced = 0
+	return s.Sync()
+}
+
+func (w *Writer) syncEvery(d time.Duration) {
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := w.Flush(); err != nil && err != os.ErrClosed {
+				log.Printf("Failed to sync: %v", err)
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Close syncs the current file if any sync policy is configured and closes it.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	close(w.done)
+
+	if w.c.SyncBytes > 0 || w.c.SyncInterval > 0 || w.c.SyncOnRotate {
+		if err := w.sync(); err != nil {
+			w.r.Close()
+			return err
+		}
+	}
+	return w.r.Close()
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package stats
+
+import "math"
+
+// Regression is a least squares fit of y = Intercept + Slope*x
+type Regression struct {
+	N                int
+	Slope, Intercept float64
+	// SlopeErr is the standard error of the slope and R2 the coefficient of
+	// determination, the fraction of the variance of y explained by the fit
+	SlopeErr, R2 float64
+}
+
+// LinearRegression fits a line through the points given by xs and ys.
+func LinearRegression(xs, ys []float64) Regression {
+	r := Regression{N: len(xs)}
+	if len(xs) == 0 || len(xs) != len(ys) {
+		return r
+	}
+
+	n := float64(len(xs))
+	var mx, my float64
+	for i := range xs {
+		mx += xs[i]
+		my += ys[i]
+	}
+	mx /= n
+	my /= n
+
+	var sxx, sxy, syy float64
+	for i := range xs {
+		dx, dy := xs[i]-mx, ys[i]-my
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if sxx == 0 {
+		r.Intercept = my
+		return r
+	}
+	r.Slope = sxy / sxx
+	r.Intercept = my - r.Slope*mx
+
+	var sse float64
+	for i := range xs {
+		e := ys[i] - (r.Intercept + r.Slope*xs[i])
+		sse += e * e
+	}
+	if syy > 0 {
+		r.R2 = 1 - sse/syy
+	}
+	if len(xs) > 2 {
+		r.SlopeErr = math.Sqrt(sse/(n-2)) / math.Sqrt(sxx)
+	} else {
+		r.SlopeErr = math.Inf(1)
+	}
+	return r
+}
+
+// t95 are the two sided 95% quantiles of the t distribution by degrees of freedom
+var t95 = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// SlopeConfidence returns the half width of the 95% confidence interval of
+// the slope, which is infinite with less than three points.
+func (r Regression) SlopeConfidence() float64 {
+	df := r.N - 2
+	switch {
+	case df < 1:
+		return math.Inf(1)
+	case df <= len(t95):
+		return t95[df-1] * r.SlopeErr
+	default:
+		return 1.96 * r.SlopeErr
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package stats
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Summary describes the distribution of a series of samples
+type Summary struct {
+	N             int
+	Min, Max      float64
+	Mean, StdDev  float64
+	P50, P90, P99 float64
+}
+
+// Summarize returns the summary of xs, which is left unchanged.
+func Summarize(xs []float64) Summary {
+	s := Summary{N: len(xs)}
+	if len(xs) == 0 {
+		return s
+	}
+
+	sorted := append([]float64(nil), xs...)
+	sort.Float64s(sorted)
+	s.Min = sorted[0]
+	s.Max = sorted[len(sorted)-1]
+	s.P50 = Percentile(sorted, 50)
+	s.P90 = Percentile(sorted, 90)
+	s.P99 = Percentile(sorted, 99)
+
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	s.Mean = sum / float64(len(xs))
+	var sq float64
+	for _, x := range xs {
+		sq += (x - s.Mean) * (x - s.Mean)
+	}
+	s.StdDev = math.Sqrt(sq / float64(len(xs)))
+	return s
+}
+
+// Percentile returns the pth percentile of the sorted samples, interpolating
+// linearly between the closest ranks.
+func Percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	r := p / 100 * float64(len(sorted)-1)
+	i := int(r)
+	if i >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (r-float64(i))*(sorted[i+1]-sorted[i])
+}
+
+// CV returns the coefficient of variation, the standard deviation relative
+// to the mean, or 0 when the mean is 0.
+func (s Summary) CV() float64 {
+	if s.Mean == 0 {
+		return 0
+	}
+	return s.StdDev / s.Mean
+}
+
+// Format formats the summary with every value formatted by the verb f,
+// e.g. "%.1f%%".
+func (s Summary) Format(f string) string {
+	v := func(x float64) string {
+		return fmt.Sprintf(f, x)
+	}
+	return fmt.Sprintf("min: %v, p50: %v, p90: %v, p99: %v, max: %v, stddev: %v", v(s.Min), v(s.P50), v(s.P90), v(s.P99), v(s.Max), v(s.StdDev))
+}
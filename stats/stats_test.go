@@ -0,0 +1,60 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	xs := []float64{5, 1, 4, 2, 3}
+	s := Summarize(xs)
+	expected := Summary{N: 5, Min: 1, Max: 5, Mean: 3, StdDev: math.Sqrt(2), P50: 3, P90: 4.6, P99: 4.96}
+	for _, c := range []struct {
+		name            string
+		value, expected float64
+	}{
+		{"min", s.Min, expected.Min},
+		{"max", s.Max, expected.Max},
+		{"mean", s.Mean, expected.Mean},
+		{"stddev", s.StdDev, expected.StdDev},
+		{"p50", s.P50, expected.P50},
+		{"p90", s.P90, expected.P90},
+		{"p99", s.P99, expected.P99},
+	} {
+		if math.Abs(c.value-c.expected) > 1e-9 {
+			t.Errorf("Expecting %v %v, got %v", c.name, c.expected, c.value)
+		}
+	}
+	if s.N != 5 {
+		t.Errorf("Expecting 5 samples, got %v", s.N)
+	}
+	if xs[0] != 5 {
+		t.Errorf("Expecting samples to be left unchanged, got %v", xs)
+	}
+	if cv := s.CV(); math.Abs(cv-math.Sqrt(2)/3) > 1e-9 {
+		t.Errorf("Expecting coefficient of variation %v, got %v", math.Sqrt(2)/3, cv)
+	}
+
+	if s := Summarize(nil); s.N != 0 || s.Max != 0 || s.CV() != 0 {
+		t.Errorf("Expecting empty summary, got %+v", s)
+	}
+}
+
+func TestLinearRegression(t *testing.T) {
+	r := LinearRegression([]float64{0, 1, 2, 3}, []float64{1, 3, 5, 7})
+	if r.Slope != 2 || r.Intercept != 1 || r.R2 != 1 || r.SlopeErr != 0 {
+		t.Errorf("Expecting exact fit with slope 2 and intercept 1, got %+v", r)
+	}
+
+	r = LinearRegression([]float64{0, 1, 2, 3, 4}, []float64{0, 2, 1, 3, 2})
+	if math.Abs(r.Slope-0.5) > 1e-9 || math.Abs(r.Intercept-0.6) > 1e-9 {
+		t.Errorf("Expecting slope 0.5 and intercept 0.6, got %+v", r)
+	}
+	if c := r.SlopeConfidence(); math.Abs(c-3.182*0.3) > 1e-9 {
+		t.Errorf("Expecting slope confidence %v, got %v", 3.182*0.3, c)
+	}
+
+	if r := LinearRegression([]float64{1}, []float64{1}); r.Slope != 0 || !math.IsInf(r.SlopeConfidence(), 1) {
+		t.Errorf("Expecting no slope from a single point, got %+v", r)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+ * SPDX-License-Identifier: MIT-0
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy of this
+ * software and associated documentation files (the "Software"), to deal in the Software
+ * without restriction, including without limitation the rights to use, copy, modify,
+ * merge, publish, distribute, sublicense, and/or sell copies of the Software, and to
+ * permit persons to whom the Software is furnished to do so.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED,
+ * INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS FOR A
+ * PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT
+ * HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION
+ * OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+ * SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package timeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is something that happened during the benchmark, like a sample of the
+// agent resource usage or a rotation of a log file.
+type Event struct {
+	Time   time.Time              `json:"time"`
+	Kind   string                 `json:"kind"`
+	Source string                 `json:"source,omitempty"`
+	Values map[string]interface{} `json:"values,omitempty"`
+}
+
+func (e Event) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%v %v", e.Time.Format("15:04:05.000"), e.Kind)
+	if e.Source != "" {
+		fmt.Fprintf(&sb, " %v", e.Source)
+	}
+
+	keys := make([]string, 0, len(e.Values))
+	for k := range e.Values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&sb, " %v=%v", k, e.Values[k])
+	}
+	return sb.String()
+}
+
+// Timeline records events in order, it is safe for concurrent use.
+type Timeline struct {
+	mu     sync.Mutex
+	events []Event
+	enc    *json.Encoder
+}
+
+// New creates a timeline, events are also written to w as JSON lines if it is not nil.
+func New(w io.Writer) *Timeline {
+	tl := &Timeline{}
+	if w != nil {
+		tl.enc = json.NewEncoder(w)
+	}
+	return tl
+}
+
+func (tl *Timeline) Record(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.events = append(tl.events, e)
+	if tl.enc != nil {
+		if err := tl.enc.Encode(e); err != nil {
+			log.Printf("Failed to write timeline event: %v", err)
+		}
+	}
+}
+
+// Since returns the events of the kinds given, or all kinds if none are
+// given, that happened after t. Events are recorded in the order Record is
+// called, which is not the order of their times when callers set them.
+func (tl *Timeline) Since(t time.Time, kinds ...string) []Event {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	var result []Event
+	for _, e := range tl.events {
+		if e.Time.After(t) && (len(kinds) == 0 || contains(kinds, e.Kind)) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// Len returns the number of events recorded
+func (tl *Timeline) Len() int {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	return len(tl.events)
+}
+
+// From returns the events of the kinds given, or all kinds if none are
+// given, recorded from the i-th one on, and the index to continue from. Paging
+// by index returns every event once, whatever their times are.
+func (tl *Timeline) From(i int, kinds ...string) ([]Event, int) {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	var result []Event
+	for _, e := range tl.events[i:] {
+		if len(kinds) == 0 || contains(kinds, e.Kind) {
+			result = append(result, e)
+		}
+	}
+	return result, len(tl.events)
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package timeline
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutOfOrder(t *testing.T) {
+	tl := New(nil)
+	start := time.Now()
+	// Callers set the times before Record takes the lock, so the second event
+	// can be recorded first and the third at the same time as the first.
+	tl.Record(Event{Time: start.Add(2 * time.Second), Kind: "rotate", Source: "a"})
+	tl.Record(Event{Time: start.Add(time.Second), Kind: "rotate", Source: "b"})
+	tl.Record(Event{Time: start.Add(2 * time.Second), Kind: "chaos", Source: "c"})
+	tl.Record(Event{Time: start.Add(3 * time.Second), Kind: "sample"})
+
+	es, next := tl.From(0, "rotate")
+	if len(es) != 2 || es[0].Source != "a" || es[1].Source != "b" || next != 4 {
+		t.Errorf("Expecting the rotations a and b and to continue from 4, got %v and %v", es, next)
+	}
+
+	tl.Record(Event{Time: start, Kind: "chaos", Source: "d"})
+	tl.Record(Event{Time: start.Add(2 * time.Second), Kind: "rotate", Source: "e"})
+	es, next = tl.From(next, "rotate", "chaos")
+	if len(es) != 2 || es[0].Source != "d" || es[1].Source != "e" || next != 6 {
+		t.Errorf("Expecting the events d and e recorded since and to continue from 6, got %v and %v", es, next)
+	}
+	if es, next := tl.From(next); len(es) != 0 || next != 6 {
+		t.Errorf("Expecting no more events, got %v and %v", es, next)
+	}
+
+	es = tl.Since(start.Add(time.Second), "rotate", "chaos")
+	if len(es) != 3 || es[0].Source != "a" || es[1].Source != "c" || es[2].Source != "e" {
+		t.Errorf("Expecting the events a, c and e after %v, got %v", start.Add(time.Second), es)
+	}
+}